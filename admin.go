@@ -0,0 +1,306 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/dustin/go-humanize"
+
+	"transfer/internal/storage"
+)
+
+// adminCommand - parent of the subcommands operating directly on the configured storage
+const adminCommand = "admin"
+
+// AdminParameters - settings of the admin subcommands
+type AdminParameters struct {
+	// ID - upload id or <id>/<filename> key
+	ID        string
+	OlderThan time.Duration
+	DryRun    bool
+	JSON      bool
+}
+
+var ap AdminParameters
+
+// errInvalidUploadID - the given id does not select an upload or a single file
+var errInvalidUploadID = errors.New("invalid upload id")
+
+// adminObject - stored object as shown by the admin subcommands
+type adminObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	Uploaded     time.Time `json:"uploaded,omitzero"`
+	Expiry       time.Time `json:"expiry,omitzero"`
+	Sha512       string    `json:"sha512,omitempty"`
+	Uploader     string    `json:"uploader,omitempty"`
+	// Downloads and MaxDownloads - download counter, MaxDownloads is omitted if unlimited
+	Downloads         string `json:"downloads,omitempty"`
+	MaxDownloads      string `json:"max_downloads,omitempty"`
+	PasswordProtected bool   `json:"password_protected"`
+	Encrypted         bool   `json:"encrypted"`
+	ClientEncryption  string `json:"client_encryption,omitempty"`
+}
+
+// adminUsage - stored files of one uploader, anonymous uploads are listed with an empty uploader
+type adminUsage struct {
+	Uploader string `json:"uploader"`
+	Files    int    `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// registerAdminCommands - add the subcommands operating on the storage configured by the server flags to app
+func registerAdminCommands(app *kingpin.Application) {
+	admin := app.Command(adminCommand, "inspect and manage the stored files using the storage flags of the server")
+	admin.Flag("json", "print the results as json").BoolVar(&ap.JSON)
+	admin.Command("list", "list all stored files")
+	admin.Command("stat", "show the metadata of the files of an upload").Arg("id", "upload id or <id>/<filename>").Required().StringVar(&ap.ID)
+	admin.Command("delete", "delete the files of an upload").Arg("id", "upload id or <id>/<filename>").Required().StringVar(&ap.ID)
+	purge := admin.Command("purge", "delete all files uploaded before a point in time")
+	purge.Flag("older-than", "minimum age of the deleted files").Required().DurationVar(&ap.OlderThan)
+	purge.Flag("dry-run", "only list the files which would be deleted").BoolVar(&ap.DryRun)
+	admin.Command("usage", "show stored files and bytes per uploader")
+}
+
+// runAdminCommand - execute the admin subcommand selected on the command line and print its results to out
+func (c *Config) runAdminCommand(ctx context.Context, command string, out io.Writer) error {
+	var result any
+	var err error
+	switch command {
+	case adminCommand + " list":
+		result, err = c.adminListAll(ctx)
+	case adminCommand + " stat":
+		result, err = c.adminStat(ctx, ap.ID)
+	case adminCommand + " delete":
+		result, err = c.adminDelete(ctx, ap.ID)
+	case adminCommand + " purge":
+		result, err = c.adminPurge(ctx, time.Now().Add(-ap.OlderThan), ap.DryRun)
+	case adminCommand + " usage":
+		result, err = c.adminUsage(ctx)
+	default:
+		return fmt.Errorf("unknown command %+q", command)
+	}
+	if err != nil {
+		return err
+	}
+
+	if ap.JSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	switch result := result.(type) {
+	case []adminObject:
+		fmt.Fprintln(table, "KEY\tSIZE\tUPLOADED\tEXPIRY")
+		for _, object := range result {
+			expiry := "-"
+			if !object.Expiry.IsZero() {
+				expiry = object.Expiry.Format(time.RFC3339)
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", object.Key, humanize.IBytes(uint64(object.Size)), object.Uploaded.Format(time.RFC3339), expiry)
+		}
+	case []adminUsage:
+		fmt.Fprintln(table, "UPLOADER\tFILES\tSIZE")
+		for _, usage := range result {
+			fmt.Fprintf(table, "%s\t%d\t%s\n", cmp.Or(usage.Uploader, "-"), usage.Files, humanize.IBytes(uint64(usage.Bytes)))
+		}
+	}
+	return table.Flush()
+}
+
+// adminKeyPrefix - storage key prefix selecting an upload id or a single <id>/<filename> key
+func adminKeyPrefix(id string) (string, error) {
+	id = strings.Trim(id, "/")
+	if id == "" || strings.Contains(id, "..") {
+		return "", fmt.Errorf("%w %+q", errInvalidUploadID, id)
+	}
+	if strings.Contains(id, "/") {
+		return id, nil
+	}
+	return id + "/", nil
+}
+
+// adminList - all objects below prefix
+func (c *Config) adminList(ctx context.Context, prefix string) ([]adminObject, error) {
+	objects := []adminObject{}
+	for object, err := range c.storage.List(ctx, prefix) {
+		if err != nil {
+			return nil, err
+		}
+		// a single key also matches keys with a longer filename
+		if !strings.HasSuffix(prefix, "/") && prefix != "" && object.Key != prefix {
+			continue
+		}
+		objects = append(objects, adminObject{Key: object.Key, Size: object.Size, LastModified: object.LastModified})
+	}
+	return objects, nil
+}
+
+// adminListAll - all stored objects including their metadata; listings only contain key, size and last
+// modification, which s3 updates on every metadata change
+func (c *Config) adminListAll(ctx context.Context) ([]adminObject, error) {
+	listed, err := c.adminList(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return c.adminDescribe(ctx, listed)
+}
+
+// adminStat - objects of an upload including their metadata
+func (c *Config) adminStat(ctx context.Context, id string) ([]adminObject, error) {
+	objects, err := c.adminFetchUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return describeObjects(objects), nil
+}
+
+// adminFetchUpload - stored objects of an upload including their metadata
+func (c *Config) adminFetchUpload(ctx context.Context, id string) ([]storage.Object, error) {
+	prefix, err := adminKeyPrefix(id)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := c.adminList(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(listed) == 0 {
+		return nil, fmt.Errorf("%s: %w", id, storage.ErrNotFound)
+	}
+	return c.adminFetch(ctx, listed)
+}
+
+// adminDescribe - add the metadata to listed objects; objects removed in the meantime are skipped
+func (c *Config) adminDescribe(ctx context.Context, listed []adminObject) ([]adminObject, error) {
+	objects, err := c.adminFetch(ctx, listed)
+	if err != nil {
+		return nil, err
+	}
+	return describeObjects(objects), nil
+}
+
+// adminFetch - stored objects including their metadata for listed objects; objects removed in the meantime are skipped
+func (c *Config) adminFetch(ctx context.Context, listed []adminObject) ([]storage.Object, error) {
+	objects := make([]storage.Object, 0, len(listed))
+	for _, entry := range listed {
+		// listings of s3 do not contain user metadata
+		object, err := c.storage.Stat(ctx, entry.Key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// describeObjects - stored objects as shown by the admin subcommands
+func describeObjects(objects []storage.Object) []adminObject {
+	described := make([]adminObject, 0, len(objects))
+	for _, object := range objects {
+		described = append(described, adminObject{
+			Key:               object.Key,
+			Size:              object.Size,
+			ContentType:       object.ContentType,
+			LastModified:      object.LastModified,
+			Uploaded:          objectUploaded(object),
+			Expiry:            objectExpiry(object),
+			Sha512:            object.UserMetadata[ChecksumMetadataFieldName],
+			Uploader:          object.UserMetadata[UploaderMetadataFieldName],
+			Downloads:         object.UserMetadata[DownloadsMetadataFieldName],
+			MaxDownloads:      object.UserMetadata[MaxDownloadsMetadataFieldName],
+			PasswordProtected: object.UserMetadata[PasswordMetadataFieldName] != "",
+			Encrypted:         object.UserMetadata[EncryptionKeyCheckMetadataFieldName] != "",
+			ClientEncryption:  object.UserMetadata[ClientEncryptionMetadataFieldName],
+		})
+	}
+	return described
+}
+
+// adminDelete - remove the objects of an upload
+func (c *Config) adminDelete(ctx context.Context, id string) ([]adminObject, error) {
+	// the uploader is needed to return the quota of the objects
+	objects, err := c.adminStat(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return objects, c.deleteObjects(ctx, objects)
+}
+
+// adminPurge - remove all objects uploaded before the given time
+func (c *Config) adminPurge(ctx context.Context, before time.Time, dryRun bool) ([]adminObject, error) {
+	objects, err := c.adminListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	objects = slices.DeleteFunc(objects, func(object adminObject) bool {
+		return !object.Uploaded.Before(before)
+	})
+	if dryRun {
+		return objects, nil
+	}
+	return objects, c.deleteObjects(ctx, objects)
+}
+
+// deleteObjects - remove objects from the storage
+func (c *Config) deleteObjects(ctx context.Context, objects []adminObject) error {
+	for _, object := range objects {
+		if err := c.storage.Delete(ctx, object.Key); err != nil {
+			return fmt.Errorf("%s: %w", object.Key, err)
+		}
+		c.releaseStoredQuota(object.Uploader, object.Size)
+	}
+	return nil
+}
+
+// adminUsage - stored files and bytes per uploader, sorted by size
+func (c *Config) adminUsage(ctx context.Context) ([]adminUsage, error) {
+	usages := make(map[string]adminUsage)
+	for listed, err := range c.storage.List(ctx, "") {
+		if err != nil {
+			return nil, err
+		}
+		// listings of s3 do not contain user metadata
+		object, err := c.storage.Stat(ctx, listed.Key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		uploader := object.UserMetadata[UploaderMetadataFieldName]
+		usages[uploader] = adminUsage{Uploader: uploader, Files: usages[uploader].Files + 1, Bytes: usages[uploader].Bytes + object.Size}
+	}
+	result := slices.AppendSeq(make([]adminUsage, 0, len(usages)), maps.Values(usages))
+	slices.SortFunc(result, func(a, b adminUsage) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), cmp.Compare(a.Uploader, b.Uploader))
+	})
+	return result, nil
+}
+
+// runAdmin - open the configured storage and execute the admin subcommand
+func runAdmin(ctx context.Context, command string) error {
+	backend, err := newStorageBackend()
+	if err != nil {
+		return err
+	}
+	c := Config{storage: backend}
+	return c.runAdminCommand(ctx, command, os.Stdout)
+}
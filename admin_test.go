@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"transfer/internal/storage"
+)
+
+// newAdminTestConfig - configuration with two uploads, the first one stored by uploader alice
+func newAdminTestConfig(t *testing.T) *Config {
+	t.Helper()
+	c := &Config{storage: storage.NewMemory(0)}
+	for key, uploader := range map[string]string{"first/a.txt": "alice", "first/b.txt": "alice", "second/c.txt": ""} {
+		ctx := context.Background()
+		if _, err := c.storage.Put(ctx, key, strings.NewReader(key), int64(len(key)), storage.PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if uploader != "" {
+			if err := c.storage.SetMetadata(ctx, key, map[string]string{UploaderMetadataFieldName: uploader}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return c
+}
+
+func TestAdminDelete(t *testing.T) {
+	tests := []struct {
+		Name      string
+		ID        string
+		Remaining []string
+	}{
+		{Name: "upload", ID: "first", Remaining: []string{"second/c.txt"}},
+		{Name: "single file", ID: "first/a.txt", Remaining: []string{"first/b.txt", "second/c.txt"}},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			c := newAdminTestConfig(t)
+			if _, err := c.adminDelete(context.Background(), test.ID); err != nil {
+				t.Fatal(err)
+			}
+			objects, err := c.adminList(context.Background(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var remaining []string
+			for _, object := range objects {
+				remaining = append(remaining, object.Key)
+			}
+			if strings.Join(remaining, ",") != strings.Join(test.Remaining, ",") {
+				t.Errorf("expected %v to remain, got %v", test.Remaining, remaining)
+			}
+		})
+	}
+
+	if _, err := newAdminTestConfig(t).adminDelete(context.Background(), "/"); err == nil {
+		t.Error("expected empty id to be rejected")
+	}
+}
+
+func TestAdminPurgeAndUsage(t *testing.T) {
+	c := newAdminTestConfig(t)
+
+	var out bytes.Buffer
+	ap = AdminParameters{}
+	if err := c.runAdminCommand(context.Background(), "admin usage", &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "alice ") || !strings.HasPrefix(lines[2], "- ") {
+		t.Errorf("unexpected usage output:\n%s", out.String())
+	}
+
+	purged, err := c.adminPurge(context.Background(), time.Now().Add(-time.Hour), false)
+	if err != nil || len(purged) != 0 {
+		t.Errorf("recent files purged: %v, %v", purged, err)
+	}
+	purged, err = c.adminPurge(context.Background(), time.Now().Add(time.Second), true)
+	if err != nil || len(purged) != 3 {
+		t.Errorf("expected all files to be selected, got %v, %v", purged, err)
+	}
+	if objects, _ := c.adminList(context.Background(), ""); len(objects) != 3 {
+		t.Errorf("dry run deleted files")
+	}
+}
+
+func TestAdminPurgeByUploadTime(t *testing.T) {
+	c := newAdminTestConfig(t)
+	ctx := context.Background()
+	// metadata changes like counted downloads do not make a file recent
+	uploaded := time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+	if err := c.storage.SetMetadata(ctx, "second/c.txt", map[string]string{UploadedMetadataFieldName: uploaded}); err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := c.adminPurge(ctx, time.Now().Add(-24*time.Hour), false)
+	if err != nil || len(purged) != 1 || purged[0].Key != "second/c.txt" {
+		t.Errorf("expected only second/c.txt to be purged, got %v, %v", purged, err)
+	}
+}
+
+func TestAdminDeleteReturnsQuota(t *testing.T) {
+	c := newAdminTestConfig(t)
+	c.quota.replace(map[string]usage{"alice": {bytes: int64(len("first/a.txt") + len("first/b.txt")), files: 2}})
+	if _, err := c.adminDelete(context.Background(), "first/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if current := c.quota.get("alice"); current.files != 1 || current.bytes != int64(len("first/b.txt")) {
+		t.Errorf("unexpected usage of alice after the deletion: %+v", current)
+	}
+}
+
+func TestAdminListShowsMetadata(t *testing.T) {
+	c := newAdminTestConfig(t)
+	ctx := context.Background()
+	uploaded := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	expiry := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	if err := c.storage.SetMetadata(ctx, "second/c.txt", map[string]string{UploadedMetadataFieldName: uploaded, ExpiryMetadataFieldName: expiry}); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	ap = AdminParameters{}
+	if err := c.runAdminCommand(ctx, "admin list", &out); err != nil {
+		t.Fatal(err)
+	}
+	for line := range strings.Lines(out.String()) {
+		if strings.HasPrefix(line, "second/c.txt ") && (!strings.Contains(line, uploaded) || !strings.Contains(line, expiry)) {
+			t.Errorf("upload time and expiry missing in %+q", line)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bonsai-oss/mux"
+	"github.com/getsentry/sentry-go"
+)
+
+// registerAdminAPI - add the admin api to the router of the metrics listener if an admin token is configured
+func (c *Config) registerAdminAPI(router *mux.Router) {
+	if p.AdminToken == "" {
+		return
+	}
+	router.HandleFunc("/admin/uploads", c.authenticateAdmin(c.AdminListHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/uploads/{id}", c.authenticateAdmin(c.AdminStatHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/uploads/{id}", c.authenticateAdmin(c.AdminDeleteHandler)).Methods(http.MethodDelete)
+	router.HandleFunc("/admin/uploads/{id}/{filename}", c.authenticateAdmin(c.AdminDeleteHandler)).Methods(http.MethodDelete)
+	router.HandleFunc("/admin/uploads/{id}/extend", c.authenticateAdmin(c.AdminExtendHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/cleanup", c.authenticateAdmin(c.AdminCleanupHandler)).Methods(http.MethodPost)
+}
+
+// authenticateAdmin - require the admin token as bearer token
+func (c *Config) authenticateAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(p.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="transfer admin"`)
+			http.Error(w, "admin token required", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// writeAdminResponse - encode result as json or report err
+func (c *Config) writeAdminResponse(w http.ResponseWriter, result any, err error) {
+	if err != nil {
+		traceLog(c.logger, err)
+		status := storageErrorStatusCode(err)
+		switch {
+		case errors.Is(err, errInvalidUploadID):
+			status = http.StatusBadRequest
+		case status == http.StatusInternalServerError:
+			sentry.CaptureException(err)
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		traceLog(c.logger, err)
+	}
+}
+
+// AdminListHandler - all stored files with their metadata
+func (c *Config) AdminListHandler(w http.ResponseWriter, r *http.Request) {
+	objects, err := c.adminListAll(r.Context())
+	c.writeAdminResponse(w, objects, err)
+}
+
+// AdminStatHandler - files of an upload with their metadata
+func (c *Config) AdminStatHandler(w http.ResponseWriter, r *http.Request) {
+	objects, err := c.adminStat(r.Context(), mux.Vars(r)["id"])
+	c.writeAdminResponse(w, objects, err)
+}
+
+// AdminDeleteHandler - force the deletion of an upload or a single file
+func (c *Config) AdminDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if filename, ok := vars["filename"]; ok {
+		id += "/" + filename
+	}
+	objects, err := c.adminDelete(r.Context(), id)
+	if err == nil {
+		traceLog(c.logger, "remove "+id+" on request of an admin")
+	}
+	c.writeAdminResponse(w, objects, err)
+}
+
+// AdminExtendHandler - postpone the expiry of all files of an upload by the duration query parameter
+func (c *Config) AdminExtendHandler(w http.ResponseWriter, r *http.Request) {
+	duration, err := time.ParseDuration(r.URL.Query().Get("duration"))
+	if err != nil || duration <= 0 {
+		http.Error(w, "positive duration query parameter required, e.g. duration=24h", http.StatusBadRequest)
+		return
+	}
+	objects, err := c.adminFetchUpload(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		c.writeAdminResponse(w, nil, err)
+		return
+	}
+	for i, object := range objects {
+		// expired files which are not yet removed are extended from now on
+		expiry := objectExpiry(object)
+		if expiry.Before(time.Now()) {
+			expiry = time.Now()
+		}
+		expiry = expiry.Add(duration).Truncate(time.Second)
+		metadata := maps.Clone(object.UserMetadata)
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[ExpiryMetadataFieldName] = expiry.UTC().Format(time.RFC3339)
+		if err := c.storage.SetMetadata(r.Context(), object.Key, metadata); err != nil {
+			c.writeAdminResponse(w, nil, err)
+			return
+		}
+		objects[i].UserMetadata = metadata
+	}
+	c.writeAdminResponse(w, describeObjects(objects), nil)
+}
+
+// AdminCleanupHandler - run the cleanup immediately and report the number of removed files
+func (c *Config) AdminCleanupHandler(w http.ResponseWriter, r *http.Request) {
+	if cancelRequestIfUnhealthy(w) {
+		return
+	}
+	removed := c.cleanup(r.Context())
+	c.writeAdminResponse(w, map[string]int{"removed": removed}, nil)
+}
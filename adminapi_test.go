@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bonsai-oss/mux"
+)
+
+func TestAdminAPI(t *testing.T) {
+	c := newAdminTestConfig(t)
+	p = Parameters{AdminToken: "admin-token", RetentionDefault: time.Hour}
+	router := mux.NewRouter()
+	c.registerAdminAPI(router)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	adminRequest := func(method string, path string, token string) (int, []adminObject) {
+		t.Helper()
+		request := mustRequest(t, method, server.URL+path, nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var objects []adminObject
+		if response.StatusCode == http.StatusOK {
+			json.NewDecoder(response.Body).Decode(&objects)
+		}
+		return response.StatusCode, objects
+	}
+
+	if status, _ := adminRequest(http.MethodGet, "/admin/uploads", "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("wrong token returned %d", status)
+	}
+	if status, objects := adminRequest(http.MethodGet, "/admin/uploads", "admin-token"); status != http.StatusOK || len(objects) != 3 || objects[0].Uploader != "alice" {
+		t.Errorf("listing returned %d %+v", status, objects)
+	}
+
+	status, objects := adminRequest(http.MethodPost, "/admin/uploads/first/extend?duration=48h", "admin-token")
+	if status != http.StatusOK || len(objects) != 2 || time.Until(objects[0].Expiry) < 48*time.Hour {
+		t.Errorf("extending returned %d %+v", status, objects)
+	}
+	if object, _ := c.storage.Stat(context.Background(), "first/a.txt"); time.Until(objectExpiry(object)) < 48*time.Hour {
+		t.Errorf("extended expiry not stored: %v", object.UserMetadata)
+	}
+
+	if status, _ := adminRequest(http.MethodDelete, "/admin/uploads/second", "admin-token"); status != http.StatusOK {
+		t.Errorf("deleting returned %d", status)
+	}
+	if status, _ := adminRequest(http.MethodGet, "/admin/uploads/second", "admin-token"); status != http.StatusNotFound {
+		t.Errorf("deleted upload returned %d", status)
+	}
+
+	// like the cleanup worker, the cleanup endpoint leaves unhealthy backends alone
+	backendState = StateUnhealthy
+	if status, _ := adminRequest(http.MethodPost, "/admin/cleanup", "admin-token"); status != http.StatusServiceUnavailable {
+		t.Errorf("cleanup of unhealthy backend returned %d", status)
+	}
+	backendState = StateHealthy
+	t.Cleanup(func() { backendState = StateUnhealthy })
+	if status, _ := adminRequest(http.MethodPost, "/admin/cleanup", "admin-token"); status != http.StatusOK {
+		t.Errorf("cleanup returned %d", status)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+
+	"filippo.io/age/armor"
+)
+
+const (
+	// clientEncryptionAge - value of the client encryption metadata for age encrypted files
+	clientEncryptionAge = "age"
+	// clientEncryptionHeader - response header announcing content the client has to decrypt
+	clientEncryptionHeader = "X-Client-Encryption"
+	// ageMagic - first line of binary age files
+	ageMagic = "age-encryption.org/v1\n"
+)
+
+// errNotAgeEncrypted - upload rejected because the server only accepts age encrypted content
+var errNotAgeEncrypted = errors.New("only age encrypted uploads are accepted")
+
+// isAgeEncrypted - whether content starts like a binary or armored age file
+func isAgeEncrypted(prefix []byte) bool {
+	return bytes.HasPrefix(prefix, []byte(ageMagic)) || bytes.HasPrefix(prefix, []byte(armor.Header))
+}
+
+// detectClientEncryption - client encryption of content starting with prefix
+func detectClientEncryption(prefix []byte) (string, error) {
+	if isAgeEncrypted(prefix) {
+		return clientEncryptionAge, nil
+	}
+	if p.RequireAge {
+		return "", errNotAgeEncrypted
+	}
+	return "", nil
+}
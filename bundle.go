@@ -0,0 +1,297 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/bonsai-oss/mux"
+	"github.com/getsentry/sentry-go"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"transfer/internal/auth"
+	"transfer/internal/encryption"
+	"transfer/internal/metrics"
+	"transfer/internal/storage"
+)
+
+// listLinkHeader - response header carrying the link listing all files of an upload
+const listLinkHeader = "X-Url-List"
+
+// checkAddableToUpload - status code describing whether filename may be added to the existing upload id by the
+// sender of r, who has to own the upload
+func (c *Config) checkAddableToUpload(r *http.Request, id string, filename string) int {
+	objects, err := c.listUpload(r.Context(), id)
+	if err != nil {
+		return storageErrorStatusCode(err)
+	}
+	if len(objects) == 0 {
+		return http.StatusNotFound
+	}
+	if status := uploadOwnership(r, objects); status != http.StatusOK {
+		return status
+	}
+	for _, object := range objects {
+		if path.Base(object.Key) == filename {
+			// never replace files of an upload
+			return http.StatusConflict
+		}
+	}
+	return http.StatusOK
+}
+
+// uploadOwnership - status code describing whether r carries the deletion token of one of the objects of an upload
+// or is authenticated as the uploader of all of them
+func uploadOwnership(r *http.Request, objects []storage.Object) int {
+	if token := requestDeletionToken(r); token != "" {
+		if slices.ContainsFunc(objects, func(object storage.Object) bool { return validDeletionToken(object, token) }) {
+			return http.StatusOK
+		}
+		return http.StatusForbidden
+	}
+	credential, authenticated := auth.FromContext(r.Context())
+	if !authenticated {
+		return http.StatusUnauthorized
+	}
+	for _, object := range objects {
+		if object.UserMetadata[UploaderMetadataFieldName] != credential.Name {
+			return http.StatusForbidden
+		}
+	}
+	return http.StatusOK
+}
+
+// listUpload - all available objects stored with the upload id
+func (c *Config) listUpload(ctx context.Context, id string) ([]storage.Object, error) {
+	var objects []storage.Object
+	for listed, err := range c.storage.List(ctx, id+"/") {
+		if err != nil {
+			return nil, err
+		}
+		// listings of s3 do not contain user metadata
+		object, err := c.storage.Stat(ctx, listed.Key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !objectGone(object, time.Now()) {
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+// resultFromObject - describe a stored object like a fresh upload. The key of encrypted objects is only known if
+// given by the client.
+func (c *Config) resultFromObject(r *http.Request, object storage.Object, key *encryption.Key) uploadResult {
+	id, filename := path.Split(object.Key)
+	id = path.Clean(id)
+	return uploadResult{
+		ID:               id,
+		Filename:         filename,
+		OriginalFilename: objectFilename(object),
+		URL:              c.signedDownloadLink(r, id, filename, objectExpiry(object), key),
+		ListURL:          c.signedListLink(r, id, objectExpiry(object)),
+		Size:             object.Size,
+		ContentType:      object.ContentType,
+		Sha512:           object.UserMetadata[ChecksumMetadataFieldName],
+		Expiry:           objectExpiry(object),
+		Uploaded:         objectUploaded(object),
+		MaxDownloads:     max(remainingDownloads(object), 0),
+		Encryption:       object.UserMetadata[ClientEncryptionMetadataFieldName],
+	}
+}
+
+// ListHandler - list all files of an upload id
+func (c *Config) ListHandler(w http.ResponseWriter, r *http.Request) {
+	handlerMainSpan := sentry.StartSpan(r.Context(), "handler.list")
+	defer handlerMainSpan.Finish()
+
+	id := mux.Vars(r)["id"]
+	if c.rejectUnsignedRequest(w, r, id) {
+		return
+	}
+
+	if cancelRequestIfUnhealthy(w) {
+		return
+	}
+
+	objects, err := c.listUpload(handlerMainSpan.Context(), id)
+	if err != nil {
+		traceLog(c.logger, err)
+		sentry.CaptureException(err)
+		w.WriteHeader(storageErrorStatusCode(err))
+		return
+	}
+	if len(objects) == 0 {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+	for _, object := range objects {
+		if rejectWithoutPassword(w, r, object) {
+			return
+		}
+	}
+
+	results := make(uploadResults, 0, len(objects))
+	for _, object := range objects {
+		results = append(results, c.resultFromObject(r, object, nil))
+	}
+
+	if responseError := writeNegotiatedResponse(w, r, results, results.writeLinks); responseError != nil {
+		traceLog(c.logger, responseError)
+	}
+}
+
+// archiveWriter - common interface of the supported bundle formats
+type archiveWriter interface {
+	// add writes the content of object to the archive
+	add(object storage.Object, content io.Reader) error
+	Close() error
+}
+
+type zipArchive struct {
+	*zip.Writer
+}
+
+func (z zipArchive) add(object storage.Object, content io.Reader) error {
+	writer, err := z.CreateHeader(&zip.FileHeader{
+		Name:     objectFilename(object),
+		Method:   zip.Deflate,
+		Modified: objectUploaded(object),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, content)
+	return err
+}
+
+type tarGzipArchive struct {
+	tarWriter  *tar.Writer
+	gzipWriter *gzip.Writer
+}
+
+func (t tarGzipArchive) add(object storage.Object, content io.Reader) error {
+	if err := t.tarWriter.WriteHeader(&tar.Header{
+		Name:    objectFilename(object),
+		Mode:    0o644,
+		Size:    object.Size,
+		ModTime: objectUploaded(object),
+	}); err != nil {
+		return err
+	}
+	_, err := io.Copy(t.tarWriter, content)
+	return err
+}
+
+func (t tarGzipArchive) Close() error {
+	return errors.Join(t.tarWriter.Close(), t.gzipWriter.Close())
+}
+
+// BundleHandler - stream all files of an upload id as zip or tar.gz archive
+func (c *Config) BundleHandler(w http.ResponseWriter, r *http.Request) {
+	handlerMainSpan := sentry.StartSpan(r.Context(), "handler.bundle")
+	defer handlerMainSpan.Finish()
+
+	vars := mux.Vars(r)
+	id, format := vars["id"], vars["format"]
+
+	if c.rejectUnsignedRequest(w, r, id) {
+		return
+	}
+
+	if cancelRequestIfUnhealthy(w) {
+		return
+	}
+
+	objects, err := c.listUpload(handlerMainSpan.Context(), id)
+	if err != nil {
+		traceLog(c.logger, err)
+		sentry.CaptureException(err)
+		w.WriteHeader(storageErrorStatusCode(err))
+		return
+	}
+	if len(objects) == 0 {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+	for _, object := range objects {
+		if rejectWithoutPassword(w, r, object) {
+			return
+		}
+		// the keys of encrypted files are only known to the holders of their download links
+		if object.UserMetadata[EncryptionKeyCheckMetadataFieldName] != "" {
+			http.Error(w, "encrypted files cannot be bundled", http.StatusConflict)
+			return
+		}
+	}
+
+	// downloads are claimed before any content is sent, so that concurrent requests cannot exceed Max-Downloads
+	if r.Method != http.MethodHead {
+		for _, object := range objects {
+			if err := c.claimDownload(handlerMainSpan.Context(), object); errors.Is(err, errDownloadsExhausted) {
+				http.Error(w, "file expired", http.StatusGone)
+				return
+			} else if err != nil {
+				traceLog(c.logger, err)
+				sentry.CaptureException(err)
+				w.WriteHeader(storageErrorStatusCode(err))
+				return
+			}
+		}
+	}
+
+	var archive archiveWriter
+	switch format {
+	case "zip":
+		w.Header().Set("Content-Type", "application/zip")
+		archive = zipArchive{zip.NewWriter(w)}
+	default:
+		w.Header().Set("Content-Type", "application/gzip")
+		gzipWriter := gzip.NewWriter(w)
+		archive = tarGzipArchive{tarWriter: tar.NewWriter(gzipWriter), gzipWriter: gzipWriter}
+	}
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", id+"."+format, id+"."+format))
+	setDownloadSecurityHeaders(w, w.Header().Get("Content-Type"))
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	metrics.ObjectAction.With(prometheus.Labels{metrics.LabelAction: "bundle"}).Inc()
+
+	archiveSpan := handlerMainSpan.StartChild("object.archive")
+	defer archiveSpan.Finish()
+	for _, object := range objects {
+		if err := c.addToArchive(archiveSpan.Context(), archive, object); err != nil {
+			// the response is already started; leaving the archive unterminated makes the failure detectable
+			archiveSpan.Status = sentry.SpanStatusInternalError
+			sentry.CaptureException(err)
+			traceLog(c.logger, err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		traceLog(c.logger, err)
+	}
+}
+
+// addToArchive - stream the content of object into archive
+func (c *Config) addToArchive(ctx context.Context, archive archiveWriter, object storage.Object) error {
+	reader, err := c.storage.Get(ctx, object.Key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return archive.add(object, reader)
+}
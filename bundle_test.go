@@ -0,0 +1,170 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"transfer/internal/auth"
+)
+
+func TestBundleDownload(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	response, err := http.DefaultClient.Do(mustRequest(t, http.MethodPut, server.URL+"/a.txt", strings.NewReader("first")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	link := strings.TrimSpace(string(body))
+	idLink := strings.TrimSuffix(link, "/a.txt")
+	deleteURL, _ := url.Parse(response.Header.Get(deleteLinkHeader))
+	token := deleteURL.Query().Get("token")
+
+	add := func(link string, token string, content string) int {
+		t.Helper()
+		request := mustRequest(t, http.MethodPut, link, strings.NewReader(content))
+		if token != "" {
+			request.Header.Set(deletionTokenHeader, token)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	if status := add(idLink+"/b.txt", "", "foreign"); status != http.StatusUnauthorized {
+		t.Errorf("adding a file without deletion token returned %d", status)
+	}
+	if status := add(idLink+"/b.txt", "wrong", "foreign"); status != http.StatusForbidden {
+		t.Errorf("adding a file with wrong deletion token returned %d", status)
+	}
+	if status := add(idLink+"/b.txt", token, "second"); status != http.StatusOK {
+		t.Fatalf("adding a file to the upload returned %d", status)
+	}
+	if status := add(idLink+"/b.txt", token, "replaced"); status != http.StatusConflict {
+		t.Errorf("replacing a file returned %d", status)
+	}
+	if status := add(server.URL+"/unknown/b.txt", token, "second"); status != http.StatusNotFound {
+		t.Errorf("adding to an unknown upload returned %d", status)
+	}
+
+	status, listing := doRequest(t, http.MethodGet, idLink+"/", nil)
+	if expected := link + "\n" + idLink + "/b.txt\n"; status != http.StatusOK || listing != expected {
+		t.Errorf("listing returned %d %+q, expected %+q", status, listing, expected)
+	}
+
+	expected := map[string]string{"a.txt": "first", "b.txt": "second"}
+
+	_, zipContent := doRequest(t, http.MethodGet, idLink+".zip", nil)
+	zipReader, err := zip.NewReader(strings.NewReader(zipContent), int64(len(zipContent)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range zipReader.File {
+		reader, _ := file.Open()
+		content, _ := io.ReadAll(reader)
+		if expected[file.Name] != string(content) {
+			t.Errorf("zip entry %+q contains %+q", file.Name, content)
+		}
+	}
+
+	_, tarContent := doRequest(t, http.MethodGet, idLink+".tar.gz", nil)
+	gzipReader, err := gzip.NewReader(bytes.NewReader([]byte(tarContent)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+	var entries int
+	for header, err := tarReader.Next(); err != io.EOF; header, err = tarReader.Next() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tarReader)
+		if expected[header.Name] != string(content) {
+			t.Errorf("tar entry %+q contains %+q", header.Name, content)
+		}
+		entries++
+	}
+	if entries != len(expected) || len(zipReader.File) != len(expected) {
+		t.Errorf("archives contain %d tar and %d zip entries", entries, len(zipReader.File))
+	}
+}
+
+func TestAddToUploadOfSameUploader(t *testing.T) {
+	server, c := newTestServer(t)
+	c.credentials = auth.Credentials{
+		{Name: "alice", Token: "alice-token"},
+		{Name: "bob", Token: "bob-token"},
+	}
+	put := func(link string, token string) (int, string) {
+		t.Helper()
+		request := mustRequest(t, http.MethodPut, link, strings.NewReader("content"))
+		request.Header.Set("Authorization", "Bearer "+token)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		return response.StatusCode, strings.TrimSpace(string(body))
+	}
+
+	_, link := put(server.URL+"/a.txt", "alice-token")
+	idLink := strings.TrimSuffix(link, "/a.txt")
+	if status, _ := put(idLink+"/b.txt", "bob-token"); status != http.StatusForbidden {
+		t.Errorf("adding to the upload of another uploader returned %d", status)
+	}
+	if status, _ := put(idLink+"/b.txt", "alice-token"); status != http.StatusOK {
+		t.Errorf("adding to an own upload returned %d", status)
+	}
+}
+
+func TestConcurrentAddToUpload(t *testing.T) {
+	server, c := newTestServer(t)
+	response, err := http.DefaultClient.Do(mustRequest(t, http.MethodPut, server.URL+"/a.txt", strings.NewReader("first")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	idLink := strings.TrimSuffix(strings.TrimSpace(string(body)), "/a.txt")
+	deleteURL, _ := url.Parse(response.Header.Get(deleteLinkHeader))
+
+	var wg sync.WaitGroup
+	var succeeded atomic.Int32
+	for range 10 {
+		wg.Go(func() {
+			request := mustRequest(t, http.MethodPut, idLink+"/b.txt", strings.NewReader("second"))
+			request.Header.Set(deletionTokenHeader, deleteURL.Query().Get("token"))
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			response.Body.Close()
+			if response.StatusCode == http.StatusOK {
+				succeeded.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	if succeeded.Load() != 1 {
+		t.Errorf("%d parallel uploads of the same file succeeded", succeeded.Load())
+	}
+	objects, err := c.listUpload(context.Background(), strings.TrimPrefix(idLink, server.URL+"/"))
+	if err != nil || len(objects) != 2 {
+		t.Errorf("upload contains %d files: %v", len(objects), err)
+	}
+}
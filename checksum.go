@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// checksumHeader - header carrying the hex encoded sha512 checksum of an upload
+const checksumHeader = "X-Checksum-Sha512"
+
+// errChecksumMismatch - uploaded content differs from a checksum announced by the client
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// digestAlgorithms - hash functions of the accepted digest algorithms named as in the http digest algorithm registry
+var digestAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// expectedDigests - checksums of an upload announced by the client, keyed by algorithm
+type expectedDigests map[string][]byte
+
+// add - record the digest of algorithm, rejecting malformed and contradicting values
+func (e expectedDigests) add(algorithm string, digest []byte) error {
+	if len(digest) != digestAlgorithms[algorithm]().Size() {
+		return fmt.Errorf("invalid %s digest length", algorithm)
+	}
+	if existing, ok := e[algorithm]; ok && !bytes.Equal(existing, digest) {
+		return fmt.Errorf("contradicting %s digests", algorithm)
+	}
+	e[algorithm] = digest
+	return nil
+}
+
+// parseExpectedDigests - read the checksums announced by Content-MD5, Digest (RFC 3230), Repr-Digest (RFC 9530) and
+// X-Checksum-Sha512; digests of unsupported algorithms are ignored
+func parseExpectedDigests(header http.Header) (expectedDigests, error) {
+	digests := expectedDigests{}
+
+	if value := header.Get("Content-MD5"); value != "" {
+		digest, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid Content-MD5: %w", err)
+		}
+		if err := digests.add("md5", digest); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, field := range headerListValues(header, "Digest") {
+		algorithm, value, _ := strings.Cut(field, "=")
+		algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+		if digestAlgorithms[algorithm] == nil {
+			continue
+		}
+		digest, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s Digest: %w", algorithm, err)
+		}
+		if err := digests.add(algorithm, digest); err != nil {
+			return nil, err
+		}
+	}
+
+	// dictionary structured field of byte sequences, e.g. sha-256=:base64:
+	for _, member := range headerListValues(header, "Repr-Digest") {
+		algorithm, value, _ := strings.Cut(member, "=")
+		algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+		if digestAlgorithms[algorithm] == nil {
+			continue
+		}
+		value, _, _ = strings.Cut(value, ";")
+		value = strings.TrimSpace(value)
+		if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			return nil, fmt.Errorf("invalid %s Repr-Digest", algorithm)
+		}
+		digest, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s Repr-Digest: %w", algorithm, err)
+		}
+		if err := digests.add(algorithm, digest); err != nil {
+			return nil, err
+		}
+	}
+
+	if value := header.Get(checksumHeader); value != "" {
+		digest, err := hex.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", checksumHeader, err)
+		}
+		if err := digests.add("sha-512", digest); err != nil {
+			return nil, err
+		}
+	}
+	return digests, nil
+}
+
+// headerListValues - members of the comma separated lists in all fields of header key
+func headerListValues(header http.Header, key string) []string {
+	var values []string
+	for _, field := range header.Values(key) {
+		for value := range strings.SplitSeq(field, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// hashes - hashes computing the announced digests; checksum is reused for sha-512
+func (e expectedDigests) hashes(checksum hash.Hash) map[string]hash.Hash {
+	hashes := make(map[string]hash.Hash, len(e))
+	for algorithm := range e {
+		if algorithm == "sha-512" {
+			hashes[algorithm] = checksum
+			continue
+		}
+		hashes[algorithm] = digestAlgorithms[algorithm]()
+	}
+	return hashes
+}
+
+// verify - compare the digests computed by hashes with the announced ones
+func (e expectedDigests) verify(hashes map[string]hash.Hash) error {
+	for algorithm, expected := range e {
+		if !bytes.Equal(hashes[algorithm].Sum(nil), expected) {
+			return fmt.Errorf("%w: %s digest differs", errChecksumMismatch, algorithm)
+		}
+	}
+	return nil
+}
+
+// verifiedPipeWriter - pipe writer holding back the last written byte until the content is verified, so that the
+// backend cannot complete storing unverified content
+type verifiedPipeWriter struct {
+	pipeWriter *io.PipeWriter
+	held       []byte
+}
+
+func (v *verifiedPipeWriter) Write(content []byte) (int, error) {
+	if len(content) == 0 {
+		return 0, nil
+	}
+	if _, err := v.pipeWriter.Write(v.held); err != nil {
+		return 0, err
+	}
+	if len(content) > 1 {
+		if _, err := v.pipeWriter.Write(content[:len(content)-1]); err != nil {
+			return 0, err
+		}
+	}
+	v.held = append(v.held[:0], content[len(content)-1])
+	return len(content), nil
+}
+
+// close - pass the held back byte on and close the pipe if the content was verified, otherwise abort it with err
+func (v *verifiedPipeWriter) close(err error) {
+	if err == nil && len(v.held) > 0 {
+		_, err = v.pipeWriter.Write(v.held)
+	}
+	v.pipeWriter.CloseWithError(err)
+}
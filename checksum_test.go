@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseExpectedDigests(t *testing.T) {
+	const content = "hello transfer"
+	md5Sum := md5.Sum([]byte(content))
+	sha256Sum := sha256.Sum256([]byte(content))
+	sha512Sum := sha512.Sum512([]byte(content))
+
+	for _, test := range []struct {
+		Name       string
+		Header     http.Header
+		Algorithms []string
+		ExpectErr  bool
+	}{
+		{
+			Name:   "no digests",
+			Header: http.Header{},
+		},
+		{
+			Name:       "content md5",
+			Header:     http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(md5Sum[:])}},
+			Algorithms: []string{"md5"},
+		},
+		{
+			Name:       "digest with unsupported algorithm",
+			Header:     http.Header{"Digest": {"UNIXsum=30637, SHA-256=" + base64.StdEncoding.EncodeToString(sha256Sum[:])}},
+			Algorithms: []string{"sha-256"},
+		},
+		{
+			Name:       "repr digest",
+			Header:     http.Header{"Repr-Digest": {"sha-512=:" + base64.StdEncoding.EncodeToString(sha512Sum[:]) + ":"}},
+			Algorithms: []string{"sha-512"},
+		},
+		{
+			Name: "matching sha512 headers",
+			Header: http.Header{
+				"Repr-Digest":       {"sha-512=:" + base64.StdEncoding.EncodeToString(sha512Sum[:]) + ":"},
+				"X-Checksum-Sha512": {hex.EncodeToString(sha512Sum[:])},
+			},
+			Algorithms: []string{"sha-512"},
+		},
+		{
+			Name: "contradicting sha512 headers",
+			Header: http.Header{
+				"Repr-Digest":       {"sha-512=:" + base64.StdEncoding.EncodeToString(sha512Sum[:]) + ":"},
+				"X-Checksum-Sha512": {strings.Repeat("00", sha512.Size)},
+			},
+			ExpectErr: true,
+		},
+		{
+			Name:      "repr digest without byte sequence",
+			Header:    http.Header{"Repr-Digest": {"sha-256=" + base64.StdEncoding.EncodeToString(sha256Sum[:])}},
+			ExpectErr: true,
+		},
+		{
+			Name:      "truncated checksum",
+			Header:    http.Header{"X-Checksum-Sha512": {hex.EncodeToString(sha512Sum[:32])}},
+			ExpectErr: true,
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			digests, err := parseExpectedDigests(test.Header)
+			if (err != nil) != test.ExpectErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(digests) != len(test.Algorithms) {
+				t.Errorf("parsed %d digests, expected %v", len(digests), test.Algorithms)
+			}
+			for _, algorithm := range test.Algorithms {
+				if _, ok := digests[algorithm]; !ok {
+					t.Errorf("missing %s digest", algorithm)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadChecksumVerification(t *testing.T) {
+	server, c := newTestServer(t)
+	const content = "hello transfer"
+	md5Sum := md5.Sum([]byte(content))
+
+	request := mustRequest(t, http.MethodPut, server.URL+"/hello.txt", strings.NewReader(content))
+	request.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5Sum[:]))
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("upload with matching checksum returned %d", response.StatusCode)
+	}
+
+	request = mustRequest(t, http.MethodPut, server.URL+"/corrupted.txt", strings.NewReader(content+"!"))
+	request.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5Sum[:]))
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("upload with mismatching checksum returned %d", response.StatusCode)
+	}
+
+	for object, err := range c.storage.List(context.Background(), "") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(object.Key, "/corrupted.txt") {
+			t.Errorf("object %+q with mismatching checksum was kept", object.Key)
+		}
+	}
+}
+
+func Test_verifiedPipeWriter(t *testing.T) {
+	for _, test := range []struct {
+		Name     string
+		Err      error
+		Expected error
+	}{
+		{Name: "verified", Expected: nil},
+		{Name: "mismatch", Err: errChecksumMismatch, Expected: errChecksumMismatch},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			pipeReader, pipeWriter := io.Pipe()
+			writer := &verifiedPipeWriter{pipeWriter: pipeWriter}
+			// like a backend expecting a known size, the reader stops after the announced bytes
+			received := make(chan error, 1)
+			go func() {
+				_, err := io.ReadFull(pipeReader, make([]byte, len("content")))
+				received <- err
+			}()
+			if _, err := writer.Write([]byte("content")); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case err := <-received:
+				t.Fatalf("content completed before its verification: %v", err)
+			case <-time.After(10 * time.Millisecond):
+			}
+			writer.close(test.Err)
+			if err := <-received; !errors.Is(err, test.Expected) {
+				t.Errorf("%v is expected but %v is resulting", test.Expected, err)
+			}
+		})
+	}
+}
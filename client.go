@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/dustin/go-humanize"
+)
+
+// ClientParameters - settings of the client subcommands
+type ClientParameters struct {
+	Server     string
+	Files      []string
+	Encrypt    bool
+	Recipients []string
+	Passphrase string
+	// Token - bearer token for servers requiring authenticated uploads
+	Token string
+	// Password - download password of protected files
+	Password   string
+	URL        string
+	Output     string
+	Identities []string
+	JSON       bool
+	Retries    int
+	NoProgress bool
+}
+
+var cp ClientParameters
+
+// clientResult - outcome of a client command per file, printed with --json
+type clientResult struct {
+	File   string `json:"file"`
+	URL    string `json:"url"`
+	Size   int64  `json:"size"`
+	Sha512 string `json:"sha512"`
+	// Verified - whether the checksum matches the one reported by the server
+	Verified bool `json:"verified"`
+}
+
+// registerClientCommands - add the subcommands talking to a transfer server to app
+func registerClientCommands(app *kingpin.Application) {
+	upload := app.Command("upload", "upload files to a transfer server and print their download links")
+	upload.Flag("server", "address of the transfer server").Envar("TRANSFER_SERVER").Default("http://localhost:8080").StringVar(&cp.Server)
+	upload.Flag("token", "bearer token for servers requiring authenticated uploads").Envar("TRANSFER_TOKEN").StringVar(&cp.Token)
+	upload.Flag("password", "protect the files with a download password").Envar("TRANSFER_PASSWORD").StringVar(&cp.Password)
+	upload.Flag("encrypt", "encrypt the files with age before uploading; the server never sees the plaintext").BoolVar(&cp.Encrypt)
+	upload.Flag("recipient", "age recipient (age1...) able to decrypt the files; repeatable").Short('r').StringsVar(&cp.Recipients)
+	upload.Flag("passphrase", "passphrase for encrypting the files if no recipient is given").Envar("TRANSFER_PASSPHRASE").StringVar(&cp.Passphrase)
+	upload.Arg("files", "files to upload").Required().ExistingFilesVar(&cp.Files)
+	registerCommonClientFlags(upload)
+
+	download := app.Command("download", "download a file, decrypting age encrypted files if an identity or passphrase is given")
+	download.Arg("url", "download link").Required().StringVar(&cp.URL)
+	download.Flag("output", "destination file, - for stdout; defaults to the filename of the link").Short('o').StringVar(&cp.Output)
+	download.Flag("password", "download password of protected files").Envar("TRANSFER_PASSWORD").StringVar(&cp.Password)
+	download.Flag("identity", "file with age identities (AGE-SECRET-KEY-1...) for decrypting; repeatable").Short('i').ExistingFilesVar(&cp.Identities)
+	download.Flag("passphrase", "passphrase for decrypting").Envar("TRANSFER_PASSPHRASE").StringVar(&cp.Passphrase)
+	registerCommonClientFlags(download)
+
+	verify := app.Command("verify", "compare the checksum of a local file with the one of a download link")
+	verify.Arg("url", "download link").Required().StringVar(&cp.URL)
+	verify.Arg("file", "local file").Required().ExistingFileVar(&cp.Output)
+	verify.Flag("password", "download password of protected files").Envar("TRANSFER_PASSWORD").StringVar(&cp.Password)
+	registerCommonClientFlags(verify)
+}
+
+// registerCommonClientFlags - add the flags shared by all client subcommands to command
+func registerCommonClientFlags(command *kingpin.CmdClause) {
+	command.Flag("json", "print the results as json").BoolVar(&cp.JSON)
+	command.Flag("retries", "attempts after failed requests due to network or server errors").Default("3").IntVar(&cp.Retries)
+	command.Flag("no-progress", "do not show progress bars").BoolVar(&cp.NoProgress)
+}
+
+// runClientCommand - execute the client subcommand selected on the command line
+func runClientCommand(ctx context.Context, command string) error {
+	var results []clientResult
+	var err error
+	switch command {
+	case "upload":
+		results, err = clientUpload(ctx)
+	case "download":
+		results, err = clientDownload(ctx)
+	case "verify":
+		results, err = clientVerify(ctx)
+	default:
+		return fmt.Errorf("unknown command %+q", command)
+	}
+	if cp.JSON && len(results) > 0 {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeError := encoder.Encode(results); encodeError != nil {
+			return encodeError
+		}
+	}
+	return err
+}
+
+// retryableError - failure which may disappear when repeating the request
+type retryableError struct {
+	error
+}
+
+func (r retryableError) Unwrap() error {
+	return r.error
+}
+
+// withRetries - run operation until it succeeds, fails permanently or --retries is exhausted
+func withRetries(ctx context.Context, operation func() error) error {
+	err := operation()
+	for attempt := 1; attempt <= cp.Retries; attempt++ {
+		var retryable retryableError
+		if !errors.As(err, &retryable) {
+			return err
+		}
+		delay := time.Second << (attempt - 1)
+		fmt.Fprintf(os.Stderr, "%v; retrying in %s\n", err, delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		err = operation()
+	}
+	return err
+}
+
+// clientDo - perform request and return the response if it was successful. The caller closes the body.
+func clientDo(request *http.Request) (*http.Response, error) {
+	if cp.Password != "" && request.Method != http.MethodPut {
+		request.SetBasicAuth("", cp.Password)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, retryableError{err}
+	}
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return response, nil
+	}
+	defer response.Body.Close()
+	answer, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	err = fmt.Errorf("%s %s failed with %s: %s", request.Method, request.URL.Redacted(), response.Status, strings.TrimSpace(string(answer)))
+	if response.StatusCode >= http.StatusInternalServerError || response.StatusCode == http.StatusTooManyRequests {
+		return nil, retryableError{err}
+	}
+	return nil, err
+}
+
+// sumLink - link of the checksum route belonging to a download link
+func sumLink(link string) (string, error) {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/") + "/sum"
+	parsed.RawPath = ""
+	return parsed.String(), nil
+}
+
+// fetchChecksum - sha512 checksum of the file behind a download link as reported by the server
+func fetchChecksum(ctx context.Context, link string) (string, error) {
+	sumURL, err := sumLink(link)
+	if err != nil {
+		return "", err
+	}
+	var checksum string
+	err = withRetries(ctx, func() error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, sumURL, nil)
+		if err != nil {
+			return err
+		}
+		response, err := clientDo(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		answer, err := io.ReadAll(response.Body)
+		if err != nil {
+			return retryableError{err}
+		}
+		fields := strings.Fields(string(answer))
+		if len(fields) == 0 {
+			return errors.New("empty checksum response")
+		}
+		checksum = fields[0]
+		return nil
+	})
+	return checksum, err
+}
+
+// progressReader - reader printing the amount of transferred bytes to stderr
+type progressReader struct {
+	reader  io.Reader
+	name    string
+	size    int64
+	done    int64
+	printed time.Time
+}
+
+// withProgress - wrap reader with a progress bar for name unless progress bars are disabled. A size of -1 denotes
+// an unknown length.
+func withProgress(reader io.Reader, name string, size int64) io.Reader {
+	if cp.NoProgress {
+		return reader
+	}
+	if info, err := os.Stderr.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return reader
+	}
+	return &progressReader{reader: reader, name: name, size: size}
+}
+
+func (progress *progressReader) Read(b []byte) (int, error) {
+	n, err := progress.reader.Read(b)
+	progress.done += int64(n)
+	if err != nil || time.Since(progress.printed) > 200*time.Millisecond {
+		progress.print(err != nil)
+	}
+	return n, err
+}
+
+func (progress *progressReader) print(final bool) {
+	progress.printed = time.Now()
+	line := fmt.Sprintf("\r%s %s", progress.name, humanize.IBytes(uint64(progress.done)))
+	if progress.size > 0 {
+		const width = 30
+		filled := int(min(progress.done*width/progress.size, width))
+		line = fmt.Sprintf("\r%s [%s%s] %s / %s", progress.name, strings.Repeat("=", filled), strings.Repeat(" ", width-filled),
+			humanize.IBytes(uint64(progress.done)), humanize.IBytes(uint64(progress.size)))
+	}
+	if final {
+		line += "\n"
+	}
+	fmt.Fprint(os.Stderr, line)
+}
+
+// ageRecipients - recipients for encrypting uploads given by --recipient or --passphrase
+func ageRecipients() ([]age.Recipient, error) {
+	if len(cp.Recipients) == 0 {
+		if cp.Passphrase == "" {
+			return nil, errors.New("--recipient or --passphrase required for encryption")
+		}
+		recipient, err := age.NewScryptRecipient(cp.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Recipient{recipient}, nil
+	}
+	recipients := make([]age.Recipient, 0, len(cp.Recipients))
+	for _, value := range cp.Recipients {
+		recipient, err := age.ParseX25519Recipient(value)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// ageIdentities - identities for decrypting downloads given by --identity or --passphrase
+func ageIdentities() ([]age.Identity, error) {
+	var identities []age.Identity
+	for _, identityFile := range cp.Identities {
+		file, err := os.Open(identityFile)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := age.ParseIdentities(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", identityFile, err)
+		}
+		identities = append(identities, parsed...)
+	}
+	if cp.Passphrase != "" {
+		identity, err := age.NewScryptIdentity(cp.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, nil
+}
+
+// clientUpload - upload every file given on the command line and verify the checksums reported by the server
+func clientUpload(ctx context.Context) ([]clientResult, error) {
+	var recipients []age.Recipient
+	if cp.Encrypt {
+		var err error
+		if recipients, err = ageRecipients(); err != nil {
+			return nil, err
+		}
+	}
+	var results []clientResult
+	for _, file := range cp.Files {
+		var result clientResult
+		err := withRetries(ctx, func() error {
+			var err error
+			result, err = uploadFile(ctx, file, recipients)
+			return err
+		})
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", file, err)
+		}
+		checksum, err := fetchChecksum(ctx, result.URL)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", file, err)
+		}
+		if result.Verified = checksum == result.Sha512; !result.Verified {
+			return append(results, result), fmt.Errorf("%s: checksum mismatch after upload", file)
+		}
+		results = append(results, result)
+		if !cp.JSON {
+			fmt.Println(result.URL)
+		}
+	}
+	return results, nil
+}
+
+// uploadFile - upload file, encrypted for recipients if given
+func uploadFile(ctx context.Context, file string, recipients []age.Recipient) (clientResult, error) {
+	result := clientResult{File: file}
+	content, err := os.Open(file)
+	if err != nil {
+		return result, err
+	}
+	defer content.Close()
+	info, err := content.Stat()
+	if err != nil {
+		return result, err
+	}
+
+	filename := filepath.Base(file)
+	var body = withProgress(content, filename, info.Size())
+	size := info.Size()
+	if len(recipients) > 0 {
+		filename += ".age"
+		size = -1
+		pipeReader, pipeWriter := io.Pipe()
+		defer pipeReader.Close()
+		plaintext := body
+		go func() {
+			encryptor, err := age.Encrypt(pipeWriter, recipients...)
+			if err == nil {
+				_, err = io.Copy(encryptor, plaintext)
+			}
+			if err == nil {
+				err = encryptor.Close()
+			}
+			pipeWriter.CloseWithError(err)
+		}()
+		body = pipeReader
+	}
+
+	// the checksum covers the content as stored by the server
+	checksum := sha512.New()
+	counter := &countingWriter{}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimSuffix(cp.Server, "/")+"/"+url.PathEscape(filename), io.TeeReader(body, io.MultiWriter(checksum, counter)))
+	if err != nil {
+		return result, err
+	}
+	request.ContentLength = size
+	if cp.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+cp.Token)
+	}
+	if cp.Password != "" {
+		request.Header.Set(downloadPasswordHeader, cp.Password)
+	}
+	response, err := clientDo(request)
+	if err != nil {
+		return result, err
+	}
+	defer response.Body.Close()
+	answer, err := io.ReadAll(response.Body)
+	if err != nil {
+		return result, retryableError{err}
+	}
+	result.URL = strings.TrimSpace(string(answer))
+	result.Size = counter.n
+	result.Sha512 = hex.EncodeToString(checksum.Sum(nil))
+	return result, nil
+}
+
+// countingWriter - discards the written content and counts its bytes
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	c.n += int64(len(b))
+	return len(b), nil
+}
+
+// clientDownload - download the file behind the link given on the command line and verify its checksum
+func clientDownload(ctx context.Context) ([]clientResult, error) {
+	identities, err := ageIdentities()
+	if err != nil {
+		return nil, err
+	}
+	link, err := url.Parse(cp.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	result := clientResult{URL: cp.URL}
+	err = withRetries(ctx, func() error {
+		var err error
+		result, err = downloadFile(ctx, link, identities)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	checksum, err := fetchChecksum(ctx, cp.URL)
+	if err != nil {
+		return nil, err
+	}
+	if result.Verified = checksum == result.Sha512; !result.Verified {
+		return []clientResult{result}, fmt.Errorf("%s: checksum mismatch after download", result.File)
+	}
+	if !cp.JSON && result.File != "-" {
+		fmt.Fprintf(os.Stderr, "%s: downloaded and verified\n", result.File)
+	}
+	return []clientResult{result}, nil
+}
+
+// downloadFile - store the file behind link, decrypting age encrypted content if identities are given
+func downloadFile(ctx context.Context, link *url.URL, identities []age.Identity) (clientResult, error) {
+	result := clientResult{URL: link.String()}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, link.String(), nil)
+	if err != nil {
+		return result, err
+	}
+	response, err := clientDo(request)
+	if err != nil {
+		return result, err
+	}
+	defer response.Body.Close()
+
+	output := cp.Output
+	if output == "" {
+		output = path.Base(link.Path)
+	}
+	// the checksum covers the content as stored by the server
+	checksum := sha512.New()
+	counter := &countingWriter{}
+	var content = io.TeeReader(withProgress(response.Body, path.Base(link.Path), response.ContentLength), io.MultiWriter(checksum, counter))
+	if response.Header.Get(clientEncryptionHeader) == clientEncryptionAge {
+		if len(identities) == 0 {
+			fmt.Fprintln(os.Stderr, "file is age encrypted, storing it without decryption")
+		} else {
+			if content, err = decryptAge(content, identities); err != nil {
+				return result, err
+			}
+			if cp.Output == "" {
+				output = strings.TrimSuffix(output, ".age")
+			}
+		}
+	}
+	result.File = output
+
+	destination := os.Stdout
+	if output != "-" {
+		if destination, err = os.Create(output); err != nil {
+			return result, err
+		}
+		defer destination.Close()
+	}
+	if _, err := io.Copy(destination, content); err != nil {
+		// content already written to stdout cannot be taken back
+		if output == "-" {
+			return result, err
+		}
+		return result, retryableError{err}
+	}
+	if output != "-" {
+		if err := destination.Close(); err != nil {
+			return result, err
+		}
+	}
+	result.Size = counter.n
+	result.Sha512 = hex.EncodeToString(checksum.Sum(nil))
+	return result, nil
+}
+
+// clientVerify - compare the checksum of the local file with the one reported for the download link
+func clientVerify(ctx context.Context) ([]clientResult, error) {
+	file, err := os.Open(cp.Output)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	checksum := sha512.New()
+	if _, err := io.Copy(checksum, withProgress(file, filepath.Base(cp.Output), info.Size())); err != nil {
+		return nil, err
+	}
+
+	result := clientResult{File: cp.Output, URL: cp.URL, Size: info.Size(), Sha512: hex.EncodeToString(checksum.Sum(nil))}
+	expected, err := fetchChecksum(ctx, cp.URL)
+	if err != nil {
+		return nil, err
+	}
+	if result.Verified = expected == result.Sha512; !result.Verified {
+		return []clientResult{result}, fmt.Errorf("%s: FAILED", cp.Output)
+	}
+	if !cp.JSON {
+		fmt.Printf("%s: OK\n", cp.Output)
+	}
+	return []clientResult{result}, nil
+}
+
+// decryptAge - decrypt binary or armored age content
+func decryptAge(content io.Reader, identities []age.Identity) (io.Reader, error) {
+	buffered := bufio.NewReader(content)
+	if prefix, _ := buffered.Peek(len(armor.Header)); string(prefix) == armor.Header {
+		return age.Decrypt(armor.NewReader(buffered), identities...)
+	}
+	return age.Decrypt(buffered, identities...)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestClientEncryptedRoundTrip(t *testing.T) {
+	server, c := newTestServer(t)
+	p.RequireAge = true
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	directory := t.TempDir()
+	source := filepath.Join(directory, "report.txt")
+	identityFile := filepath.Join(directory, "identity.txt")
+	if err := os.WriteFile(source, []byte("plaintext report"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _ := doRequest(t, http.MethodPut, server.URL+"/plain.txt", strings.NewReader("plaintext")); status != http.StatusUnsupportedMediaType {
+		t.Errorf("plaintext upload returned %d", status)
+	}
+
+	cp = ClientParameters{Server: server.URL, Files: []string{source}, Encrypt: true, Recipients: []string{identity.Recipient().String()}}
+	results, err := clientUpload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := results[0].URL
+	if !results[0].Verified {
+		t.Error("upload checksum not verified")
+	}
+	if !strings.HasSuffix(link, "/report.txt.age") {
+		t.Fatalf("unexpected download link %+q", link)
+	}
+
+	object, err := c.storage.Stat(context.Background(), strings.TrimPrefix(link, server.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.UserMetadata[ClientEncryptionMetadataFieldName] != clientEncryptionAge {
+		t.Errorf("upload not marked as age encrypted: %v", object.UserMetadata)
+	}
+
+	destination := filepath.Join(directory, "downloaded.txt")
+	cp = ClientParameters{URL: link, Output: destination, Identities: []string{identityFile}}
+	if _, err := clientDownload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(destination); err != nil || string(content) != "plaintext report" {
+		t.Errorf("decrypted content %+q, %v", content, err)
+	}
+}
+
+func TestClientVerify(t *testing.T) {
+	server, _ := newTestServer(t)
+	directory := t.TempDir()
+	original, modified := filepath.Join(directory, "original.txt"), filepath.Join(directory, "modified.txt")
+	os.WriteFile(original, []byte("original"), 0o600)
+	os.WriteFile(modified, []byte("modified"), 0o600)
+
+	status, link := doRequest(t, http.MethodPut, server.URL+"/original.txt", strings.NewReader("original"))
+	if status != http.StatusOK {
+		t.Fatalf("upload failed with status %d", status)
+	}
+
+	tests := []struct {
+		Name     string
+		File     string
+		Verified bool
+	}{
+		{Name: "same content", File: original, Verified: true},
+		{Name: "different content", File: modified, Verified: false},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			cp = ClientParameters{URL: strings.TrimSpace(link), Output: test.File, JSON: true}
+			results, err := clientVerify(context.Background())
+			if (err == nil) != test.Verified || len(results) != 1 || results[0].Verified != test.Verified {
+				t.Errorf("expected verified %v, got %+v with %v", test.Verified, results, err)
+			}
+		})
+	}
+}
+
+func TestWithRetries(t *testing.T) {
+	cp = ClientParameters{Retries: 2}
+	var attempts int
+	err := withRetries(context.Background(), func() error {
+		attempts++
+		if attempts < 2 {
+			return retryableError{errors.New("temporary failure")}
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("expected success after 2 attempts, got %d attempts and %v", attempts, err)
+	}
+
+	attempts = 0
+	permanent := errors.New("permanent failure")
+	if err := withRetries(context.Background(), func() error { attempts++; return permanent }); err != permanent || attempts != 1 {
+		t.Errorf("permanent failure retried %d times: %v", attempts, err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// defaultInlineTypes - media types browsers may display inline; none of them can execute scripts
+var defaultInlineTypes = []string{
+	"text/plain",
+	"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif", "image/bmp",
+	"video/mp4", "video/webm", "video/ogg",
+	"audio/mpeg", "audio/ogg", "audio/wav", "audio/webm", "audio/flac", "audio/aac",
+	"application/pdf",
+}
+
+// downloadContentSecurityPolicy - policy of served files; even if a browser renders one, it may not run scripts or
+// load anything else
+const downloadContentSecurityPolicy = "default-src 'none'; img-src 'self' data:; media-src 'self'; style-src 'unsafe-inline'"
+
+// mediaType - content type without parameters in lower case
+func mediaType(contentType string) string {
+	value, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// inlineAllowed - whether content of contentType may be displayed by browsers
+func inlineAllowed(contentType string) bool {
+	return slices.Contains(p.InlineTypes, mediaType(contentType))
+}
+
+// servedContentType - content type sent for a stored file; types outside the allowlist are served as opaque bytes
+func servedContentType(contentType string) string {
+	if inlineAllowed(contentType) {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// setDownloadSecurityHeaders - headers preventing browsers from rendering downloads as active content
+func setDownloadSecurityHeaders(w http.ResponseWriter, contentType string) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	policy := downloadContentSecurityPolicy
+	// the pdf viewers of browsers refuse to work in sandboxed documents
+	if mediaType(contentType) != "application/pdf" {
+		policy += "; sandbox"
+	}
+	w.Header().Set("Content-Security-Policy", policy)
+}
+
+// setPageSecurityHeaders - headers of the html pages of the browser interface
+func setPageSecurityHeaders(w http.ResponseWriter) {
+	content := "'self'"
+	if origin := contentOrigin(); origin != "" {
+		content += " " + origin
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; img-src "+content+"; media-src "+content+"; frame-src "+content+
+		"; object-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'")
+}
+
+// contentOrigin - origin of the separate domain serving file contents, empty if files are served by every host
+func contentOrigin() string {
+	if p.ContentDomain == "" {
+		return ""
+	}
+	return p.DownloadLinkPrefix + "://" + p.ContentDomain
+}
+
+// onContentDomain - whether r was sent to the separate domain serving file contents
+func onContentDomain(r *http.Request) bool {
+	if p.ContentDomain == "" {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return strings.EqualFold(r.Host, p.ContentDomain) || strings.EqualFold(host, p.ContentDomain)
+}
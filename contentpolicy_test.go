@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestContentPolicy(t *testing.T) {
+	server, _ := newTestServer(t)
+	p.ContentDomain = "usercontent.example.com"
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	upload := func(filename string, content string) string {
+		t.Helper()
+		status, link := doRequest(t, http.MethodPut, server.URL+"/"+filename, strings.NewReader(content))
+		if status != http.StatusOK {
+			t.Fatalf("upload of %s failed with status %d", filename, status)
+		}
+		return strings.TrimSpace(link)
+	}
+	html := upload("evil.html", "<script>alert(1)</script>")
+	svg := upload("evil.svg", `<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)
+	png := upload("image.png", "\x89PNG\r\n\x1a\n")
+
+	tests := []struct {
+		Name        string
+		URL         string
+		Host        string
+		Status      int
+		ContentType string
+		Disposition string
+	}{
+		{Name: "html", URL: html + "?inline=1", Host: p.ContentDomain, Status: http.StatusOK, ContentType: "application/octet-stream", Disposition: "attachment"},
+		{Name: "svg", URL: svg + "?inline=1", Host: p.ContentDomain, Status: http.StatusOK, ContentType: "application/octet-stream", Disposition: "attachment"},
+		{Name: "png inline", URL: png + "?inline=1", Host: p.ContentDomain, Status: http.StatusOK, ContentType: "image/png", Disposition: "inline"},
+		{Name: "png attachment", URL: png, Status: http.StatusOK, ContentType: "image/png", Disposition: "attachment"},
+		{Name: "inline outside content domain", URL: png + "?inline=1", Status: http.StatusTemporaryRedirect},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			request := mustRequest(t, http.MethodGet, test.URL, nil)
+			if test.Host != "" {
+				request.Host = test.Host
+			}
+			response, err := client.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if response.StatusCode != test.Status {
+				t.Fatalf("expected status %d, got %d", test.Status, response.StatusCode)
+			}
+			if test.Status != http.StatusOK {
+				if location := response.Header.Get("Location"); !strings.HasPrefix(location, "http://"+p.ContentDomain+"/") {
+					t.Errorf("unexpected redirect to %+q", location)
+				}
+				return
+			}
+			if contentType := response.Header.Get("Content-Type"); contentType != test.ContentType {
+				t.Errorf("expected content type %+q, got %+q", test.ContentType, contentType)
+			}
+			if disposition := response.Header.Get("Content-Disposition"); !strings.HasPrefix(disposition, test.Disposition+";") {
+				t.Errorf("expected %s disposition, got %+q", test.Disposition, disposition)
+			}
+			if response.Header.Get("X-Content-Type-Options") != "nosniff" || !strings.Contains(response.Header.Get("Content-Security-Policy"), "sandbox") {
+				t.Errorf("security headers missing: %v", response.Header)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/bonsai-oss/mux"
+	"github.com/getsentry/sentry-go"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"transfer/internal/metrics"
+	"transfer/internal/storage"
+)
+
+const (
+	// deletionTokenHeader - request header carrying the deletion token as alternative to the token query parameter
+	deletionTokenHeader = "X-Deletion-Token"
+	// deleteLinkHeader - response header carrying the link for deleting a fresh upload
+	deleteLinkHeader = "X-Url-Delete"
+)
+
+// hashDeletionToken - representation of a deletion token stored in the object metadata
+func hashDeletionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestDeletionToken - deletion token sent as token query parameter or X-Deletion-Token header
+func requestDeletionToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	return r.Header.Get(deletionTokenHeader)
+}
+
+// validDeletionToken - whether token matches the deletion token of object
+func validDeletionToken(object storage.Object, token string) bool {
+	expectedHash := object.UserMetadata[DeletionTokenMetadataFieldName]
+	return expectedHash != "" && subtle.ConstantTimeCompare([]byte(hashDeletionToken(token)), []byte(expectedHash)) == 1
+}
+
+// deleteLink - link for deleting the object with the given download link
+func deleteLink(downloadLink string, token string) string {
+	return downloadLink + "?" + url.Values{"token": {token}}.Encode()
+}
+
+// DeleteHandler - remove an uploaded file if the request carries its deletion token
+func (c *Config) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	handlerMainSpan := sentry.StartSpan(r.Context(), "handler.delete")
+	defer handlerMainSpan.Finish()
+
+	vars := mux.Vars(r)
+	filePath := fmt.Sprintf("%s/%s", vars["id"], vars["filename"])
+
+	token := requestDeletionToken(r)
+	if token == "" {
+		http.Error(w, "deletion token not provided", http.StatusUnauthorized)
+		return
+	}
+
+	if cancelRequestIfUnhealthy(w) {
+		return
+	}
+
+	object, err := c.storage.Stat(handlerMainSpan.Context(), filePath)
+	if err != nil {
+		traceLog(c.logger, err)
+		w.WriteHeader(storageErrorStatusCode(err))
+		return
+	}
+
+	if !validDeletionToken(object, token) {
+		http.Error(w, "invalid deletion token", http.StatusForbidden)
+		return
+	}
+
+	if err := c.storage.Delete(handlerMainSpan.Context(), filePath); err != nil {
+		traceLog(c.logger, err)
+		sentry.CaptureException(err)
+		w.WriteHeader(storageErrorStatusCode(err))
+		return
+	}
+	c.releaseStoredQuota(object.UserMetadata[UploaderMetadataFieldName], object.Size)
+	metrics.ObjectAction.With(prometheus.Labels{metrics.LabelAction: "delete"}).Inc()
+	traceLog(c.logger, "remove "+filePath+" on request of the uploader")
+	w.WriteHeader(http.StatusNoContent)
+}
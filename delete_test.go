@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDeleteWithToken(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	response, err := http.DefaultClient.Do(mustRequest(t, http.MethodPut, server.URL+"/secret.txt", strings.NewReader("content")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	link := strings.TrimSpace(string(body))
+	deleteURL := response.Header.Get(deleteLinkHeader)
+	if !strings.HasPrefix(deleteURL, link+"?token=") {
+		t.Fatalf("unexpected delete link %+q", deleteURL)
+	}
+
+	if status, _ := doRequest(t, http.MethodDelete, link, nil); status != http.StatusUnauthorized {
+		t.Errorf("delete without token returned %d", status)
+	}
+	if status, _ := doRequest(t, http.MethodDelete, link+"?token=wrong", nil); status != http.StatusForbidden {
+		t.Errorf("delete with wrong token returned %d", status)
+	}
+	if status, _ := doRequest(t, http.MethodDelete, deleteURL, nil); status != http.StatusNoContent {
+		t.Errorf("delete with token returned %d", status)
+	}
+	if status, _ := doRequest(t, http.MethodGet, link, nil); status != http.StatusNotFound {
+		t.Errorf("deleted file returned %d", status)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"transfer/internal/encryption"
+	"transfer/internal/storage"
+)
+
+// objectEncryptionKey - key for decrypting object parsed from the value given in the download link. The key is nil
+// for unencrypted objects, the status reports missing or wrong keys.
+func objectEncryptionKey(object storage.Object, value string) (*encryption.Key, int) {
+	check := object.UserMetadata[EncryptionKeyCheckMetadataFieldName]
+	if check == "" {
+		return nil, http.StatusOK
+	}
+	key, err := encryption.ParseKey(value)
+	if err != nil || subtle.ConstantTimeCompare([]byte(key.Check()), []byte(check)) != 1 {
+		return nil, http.StatusForbidden
+	}
+	return &key, http.StatusOK
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedUpload(t *testing.T) {
+	server, c := newTestServer(t)
+	p.EncryptionEnable = true
+	content := strings.Repeat("sensitive ", 1000)
+
+	status, link := doRequest(t, http.MethodPut, server.URL+"/secret.txt", strings.NewReader(content))
+	if status != http.StatusOK {
+		t.Fatalf("upload failed with status %d: %s", status, link)
+	}
+	link = strings.TrimSpace(link)
+	path := strings.Split(strings.TrimPrefix(link, server.URL+"/"), "/")
+	if len(path) != 3 {
+		t.Fatalf("expected key in download link %+q", link)
+	}
+	id, filename := path[0], path[2]
+
+	stored, err := c.storage.Get(context.Background(), id+"/"+filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stored.Close()
+	var storedContent bytes.Buffer
+	storedContent.ReadFrom(stored)
+	if storedContent.String() == content || storedContent.Len() != len(content) {
+		t.Error("stored content is not encrypted in place")
+	}
+
+	if status, body := doRequest(t, http.MethodGet, link, nil); status != http.StatusOK || body != content {
+		t.Errorf("download returned %d", status)
+	}
+	sum := sha512.Sum512([]byte(content))
+	if status, body := doRequest(t, http.MethodGet, link+"/sum", nil); status != http.StatusOK || !strings.HasPrefix(body, hex.EncodeToString(sum[:])) {
+		t.Errorf("checksum does not match the plaintext: %d %+q", status, body)
+	}
+	if status, _ := doRequest(t, http.MethodGet, server.URL+"/"+id+"/"+filename, nil); status != http.StatusForbidden {
+		t.Errorf("download without key returned %d", status)
+	}
+
+	request := mustRequest(t, http.MethodGet, link, nil)
+	request.Header.Set("Range", "bytes=5-14")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var partial bytes.Buffer
+	partial.ReadFrom(response.Body)
+	if response.StatusCode != http.StatusPartialContent || partial.String() != content[5:15] {
+		t.Errorf("range request returned %d %+q", response.StatusCode, partial.String())
+	}
+}
+
+func TestEncryptedFilesNamedLikeSubresources(t *testing.T) {
+	server, _ := newTestServer(t)
+	p.EncryptionEnable = true
+
+	for _, filename := range []string{"sum", "info"} {
+		status, link := doRequest(t, http.MethodPut, server.URL+"/"+filename, strings.NewReader("content of "+filename))
+		if status != http.StatusOK {
+			t.Fatalf("upload of %+q failed with status %d", filename, status)
+		}
+		link = strings.TrimSpace(link)
+		if status, body := doRequest(t, http.MethodGet, link, nil); status != http.StatusOK || body != "content of "+filename {
+			t.Errorf("download of %+q returned %d %+q", filename, status, body)
+		}
+		if status, _ := doRequest(t, http.MethodGet, link+"/info", nil); status != http.StatusOK {
+			t.Errorf("info of %+q returned %d", filename, status)
+		}
+	}
+}
+
+func TestEncryptedFormUploadUsesKeyPerFile(t *testing.T) {
+	server, _ := newTestServer(t)
+	p.EncryptionEnable = true
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, filename := range []string{"first.txt", "second.txt"} {
+		part, _ := form.CreateFormFile("file", filename)
+		part.Write([]byte("content of " + filename))
+	}
+	form.Close()
+
+	request := mustRequest(t, http.MethodPost, server.URL+"/", &body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var links bytes.Buffer
+	links.ReadFrom(response.Body)
+
+	keys := map[string]bool{}
+	for _, link := range strings.Fields(links.String()) {
+		keys[strings.Split(strings.TrimPrefix(link, server.URL+"/"), "/")[1]] = true
+	}
+	if response.StatusCode != http.StatusOK || len(keys) != 2 {
+		t.Errorf("form upload returned %d with keys %v", response.StatusCode, keys)
+	}
+}
@@ -1,21 +1,29 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"crypto/cipher"
 	"crypto/sha512"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
+	"slices"
 	"strconv"
+	"text/tabwriter"
+	"time"
 
 	"github.com/bonsai-oss/mux"
+	"github.com/dustin/go-humanize"
 	"github.com/getsentry/sentry-go"
 	"github.com/google/uuid"
-	"github.com/minio/minio-go/v7"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"transfer/internal/encryption"
 	"transfer/internal/metrics"
+	"transfer/internal/storage"
 )
 
 func (c *Config) HealthCheckHandler(w http.ResponseWriter, _ *http.Request) {
@@ -37,6 +45,8 @@ func (c *Config) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	// check if handler is called with /.../.../sum
 	_, sumMode := vars["sum"]
+	// check if handler is called with /.../.../info
+	_, infoMode := vars["info"]
 
 	id, idOK := vars["id"]
 	filename, filenameOK := vars["filename"]
@@ -46,6 +56,11 @@ func (c *Config) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if c.rejectUnsignedRequest(w, r, id+"/"+filename) {
+		transaction.Status = sentry.SpanStatusPermissionDenied
+		return
+	}
+
 	if cancelRequestIfUnhealthy(w) {
 		return
 	}
@@ -54,9 +69,9 @@ func (c *Config) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 	statSpan.Status = sentry.SpanStatusOK
 
 	filePath := fmt.Sprintf("%s/%s", id, filename)
-	object, err := c.minioClient.StatObject(statSpan.Context(), p.S3BucketName, filePath, minio.StatObjectOptions{})
+	object, err := c.storage.Stat(statSpan.Context(), filePath)
 	if err != nil {
-		switch minio.ToErrorResponse(err).StatusCode {
+		switch storageErrorStatusCode(err) {
 		case http.StatusNotFound:
 			statSpan.Status = sentry.SpanStatusNotFound
 			transaction.Status = sentry.SpanStatusNotFound
@@ -64,9 +79,9 @@ func (c *Config) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 			statSpan.Status = sentry.SpanStatusInternalError
 			transaction.Status = sentry.SpanStatusInternalError
 		}
-		sentry.CaptureException(fmt.Errorf("%s: %s", err.Error(), r.URL.String()))
+		sentry.CaptureException(fmt.Errorf("%s: %s", err.Error(), metrics.RedactURL(r.URL.String())))
 		statSpan.Finish()
-		w.WriteHeader(minio.ToErrorResponse(err).StatusCode)
+		w.WriteHeader(storageErrorStatusCode(err))
 		traceLog(c.logger, err)
 		return
 	}
@@ -75,135 +90,494 @@ func (c *Config) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	statSpan.Finish()
 
+	if objectGone(object, time.Now()) {
+		transaction.Status = sentry.SpanStatusNotFound
+		http.Error(w, "file expired", http.StatusGone)
+		return
+	}
+
+	if rejectWithoutPassword(w, r, object) {
+		transaction.Status = sentry.SpanStatusUnauthenticated
+		return
+	}
+
+	key, keyStatus := objectEncryptionKey(object, vars["key"])
+	if keyStatus != http.StatusOK {
+		transaction.Status = sentry.SpanStatusPermissionDenied
+		http.Error(w, "missing or invalid encryption key", keyStatus)
+		return
+	}
+
 	// only return checksum when called in sum mode
 	if sumMode {
 		metrics.ObjectAction.With(prometheus.Labels{metrics.LabelAction: "sum"}).Inc()
-		_, httpResponseError := fmt.Fprintf(w, "%s  %s\n", object.UserMetadata[ChecksumMetadataFieldName], filename)
+		httpResponseError := writeNegotiatedResponse(w, r, c.resultFromObject(r, object, key), func(out io.Writer) error {
+			_, err := fmt.Fprintf(out, "%s  %s\n", object.UserMetadata[ChecksumMetadataFieldName], filename)
+			return err
+		})
 		if httpResponseError != nil {
-			sentry.CaptureMessage(fmt.Sprintf("%s: %s", err.Error(), r.URL.String()))
-			w.WriteHeader(http.StatusInternalServerError)
+			sentry.CaptureMessage(fmt.Sprintf("%s: %s", httpResponseError.Error(), metrics.RedactURL(r.URL.String())))
+			traceLog(c.logger, httpResponseError)
 		}
 		return
 	}
 
-	w.Header().Set("Content-Type", object.ContentType)
-	w.Header().Set("Content-Length", strconv.FormatInt(object.Size, 10))
-	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
-
-	if r.Method == http.MethodHead {
+	// only describe the object when called in info mode
+	if infoMode {
+		metrics.ObjectAction.With(prometheus.Labels{metrics.LabelAction: "info"}).Inc()
+		result := c.resultFromObject(r, object, key)
+		if httpResponseError := writeNegotiatedResponse(w, r, result, result.writeInfo); httpResponseError != nil {
+			traceLog(c.logger, httpResponseError)
+		}
 		return
 	}
 
-	objectGetSpan := handlerMainSpan.StartChild("object.get")
-	reader, err := c.minioClient.GetObject(objectGetSpan.Context(), p.S3BucketName, object.Key, minio.GetObjectOptions{})
-	if err != nil {
-		objectGetSpan.Status = sentry.SpanStatusInternalError
-		objectGetSpan.Finish()
-		traceLog(c.logger, err)
-		w.WriteHeader(http.StatusInternalServerError)
+	// browsers navigating to the link get a preview page, curl and embedded previews the content
+	if wantsPreview(r) {
+		c.renderPreview(w, r, object, key)
 		return
 	}
-	objectGetSpan.Finish()
 
-	metrics.ObjectAction.With(prometheus.Labels{metrics.LabelAction: "download"}).Inc()
+	// files displayed by the preview page are only served by the content domain if configured
+	if r.URL.Query().Has("inline") && contentOrigin() != "" && !onContentDomain(r) {
+		http.Redirect(w, r, contentOrigin()+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+		return
+	}
 
+	// ServeContent answers range and conditional requests; the object is only fetched if content is sent
 	objectCopySpan := handlerMainSpan.StartChild("object.copy")
-	defer objectCopySpan.Finish()
-	if _, copyError := io.Copy(w, reader); err != nil {
+	reader := &lazyObjectReader{
+		open: func() (io.ReadSeekCloser, error) {
+			content, err := c.storage.Get(objectCopySpan.Context(), object.Key)
+			if err != nil {
+				return nil, err
+			}
+			// every request receiving content counts against Max-Downloads, including range requests; the download
+			// is claimed before any content is sent, so that concurrent requests cannot exceed the limit
+			if err := c.claimDownload(objectCopySpan.Context(), object); err != nil {
+				content.Close()
+				return nil, err
+			}
+			if key == nil {
+				return content, nil
+			}
+			return encryption.NewReader(content, *key), nil
+		},
+		size: object.Size,
+	}
+	defer reader.Close()
+	// requests which certainly receive content open the object before the response is sent, so that storage errors
+	// are not reported as successful but truncated download
+	if r.Method != http.MethodHead && !conditionalRequest(r) {
+		if err := reader.prepare(); errors.Is(err, errDownloadsExhausted) {
+			objectCopySpan.Finish()
+			transaction.Status = sentry.SpanStatusNotFound
+			http.Error(w, "file expired", http.StatusGone)
+			return
+		} else if err != nil {
+			objectCopySpan.Status = sentry.SpanStatusInternalError
+			objectCopySpan.Finish()
+			sentry.CaptureException(err)
+			traceLog(c.logger, err)
+			w.WriteHeader(storageErrorStatusCode(err))
+			return
+		}
+	}
+
+	contentType := servedContentType(object.ContentType)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	setDownloadSecurityHeaders(w, contentType)
+	if clientEncryption := object.UserMetadata[ClientEncryptionMetadataFieldName]; clientEncryption != "" {
+		w.Header().Set(clientEncryptionHeader, clientEncryption)
+	}
+	disposition := "attachment"
+	// previews only display types which cannot run scripts in the context of this site
+	if r.URL.Query().Has("inline") && inlineAllowed(contentType) {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Disposition", contentDisposition(disposition, objectFilename(object), filename))
+	if object.ETag != "" {
+		w.Header().Set("ETag", strconv.Quote(object.ETag))
+	}
+
+	http.ServeContent(w, r, filename, objectUploaded(object), reader)
+	if reader.err != nil {
 		objectCopySpan.Status = sentry.SpanStatusInternalError
 		objectCopySpan.Finish()
-		traceLog(c.logger, copyError)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		if !errors.Is(reader.err, errDownloadsExhausted) {
+			sentry.CaptureException(reader.err)
+		}
+		traceLog(c.logger, reader.err)
+		// the status was already sent; aborting the connection shows the client that the download is incomplete
+		panic(http.ErrAbortHandler)
+	}
+	objectCopySpan.Finish()
+
+	if reader.contentRead() {
+		metrics.ObjectAction.With(prometheus.Labels{metrics.LabelAction: "download"}).Inc()
 	}
 }
 
-func (c *Config) UploadHandler(w http.ResponseWriter, r *http.Request) {
-	handlerMainSpan := sentry.StartSpan(r.Context(), "handler.upload")
-	defer handlerMainSpan.Finish()
+// uploadResult - description of a stored upload returned to the client
+type uploadResult struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	// OriginalFilename - filename given by the uploader, Filename is its ascii slug used in links
+	OriginalFilename string    `json:"original_filename"`
+	URL              string    `json:"url"`
+	Size             int64     `json:"size"`
+	ContentType      string    `json:"content_type"`
+	Sha512           string    `json:"sha512"`
+	Expiry           time.Time `json:"expiry"`
+	// Uploaded - time of the upload, omitted directly after the upload
+	Uploaded time.Time `json:"uploaded,omitzero"`
+	// MaxDownloads - remaining downloads, omitted if unlimited
+	MaxDownloads int `json:"max_downloads,omitempty"`
+	// ListURL - link listing all files of the upload id
+	ListURL string `json:"list_url"`
+	// DeleteURL - link for deleting the file, only known directly after the upload
+	DeleteURL string `json:"delete_url,omitempty"`
+	// Encryption - encryption applied by the client, e.g. age
+	Encryption string `json:"encryption,omitempty"`
+}
 
-	vars := mux.Vars(r)
-	filename, ok := vars["filename"]
-	filename = url.QueryEscape(filename)
-	filename = onlyAllowedCharacters(filename)
+// writeInfo - print the description as human readable list
+func (u uploadResult) writeInfo(out io.Writer) error {
+	remainingDownloads := "unlimited"
+	if u.MaxDownloads > 0 {
+		remainingDownloads = strconv.Itoa(u.MaxDownloads)
+	}
+	table := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(table, "filename:\t%s\n", u.OriginalFilename)
+	fmt.Fprintf(table, "size:\t%d (%s)\n", u.Size, humanize.IBytes(uint64(u.Size)))
+	fmt.Fprintf(table, "content type:\t%s\n", u.ContentType)
+	fmt.Fprintf(table, "uploaded:\t%s\n", u.Uploaded.UTC().Format(time.RFC3339))
+	fmt.Fprintf(table, "expiry:\t%s\n", u.Expiry.UTC().Format(time.RFC3339))
+	fmt.Fprintf(table, "remaining downloads:\t%s\n", remainingDownloads)
+	if u.Encryption != "" {
+		fmt.Fprintf(table, "encryption:\t%s\n", u.Encryption)
+	}
+	fmt.Fprintf(table, "sha512:\t%s\n", u.Sha512)
+	return table.Flush()
+}
 
-	if cancelRequestIfUnhealthy(w) {
-		return
+// uploadResults - descriptions of several files
+type uploadResults []uploadResult
+
+// writeLinks - print one download link per line
+func (u uploadResults) writeLinks(out io.Writer) error {
+	for _, result := range u {
+		if _, err := fmt.Fprintln(out, result.URL); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	if !ok || filename == "" {
-		http.Error(w, "filename not provided", http.StatusBadRequest)
-		return
+// uploadErrorStatusCode - map errors returned by storeUpload to http status codes
+func uploadErrorStatusCode(err error) int {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return http.StatusRequestEntityTooLarge
 	}
-	if r.ContentLength > p.UploadLimitGB*metrics.GB {
-		sentry.CaptureMessage("upload too large")
-		http.Error(w, "upload too large", http.StatusRequestEntityTooLarge)
-		return
+	if errors.Is(err, errNotAgeEncrypted) {
+		return http.StatusUnsupportedMediaType
+	}
+	if errors.Is(err, errChecksumMismatch) {
+		return http.StatusBadRequest
 	}
+	return storageErrorStatusCode(err)
+}
 
-	metadata := make(map[string]string)
+// uploadErrorMessage - response text for a failed upload; only errors caused by the client are described
+func uploadErrorMessage(err error) string {
+	if errors.Is(err, errChecksumMismatch) {
+		return err.Error()
+	}
+	return http.StatusText(uploadErrorStatusCode(err))
+}
+
+// storeUpload - stream body into the storage backend as <id>/<filename> and attach the checksum and options. A size
+// of -1 denotes an unknown length.
+func (c *Config) storeUpload(handlerMainSpan *sentry.Span, r *http.Request, id string, filename string, body io.Reader, size int64, options uploadOptions) (uploadResult, error) {
+	var contentType string
+	var err error
+	if contentType, options.clientEncryption, body, err = inspectContent(filename, body); err != nil {
+		return uploadResult{}, err
+	}
+	metadata := options.metadata()
 	sha512SumGenerator := sha512.New()
+	digestHashes := options.digests.hashes(sha512SumGenerator)
+	// empty content may be stored without reading anything from the pipe
+	if size == 0 {
+		if err := options.digests.verify(digestHashes); err != nil {
+			return uploadResult{}, err
+		}
+	}
 
 	pipeReader, pipeWriter := io.Pipe()
-	multiWriter := io.MultiWriter(sha512SumGenerator, pipeWriter)
+	verifiedWriter := &verifiedPipeWriter{pipeWriter: pipeWriter}
+	// the checksum covers the plaintext, only the stored content is encrypted
+	var contentWriter io.Writer = verifiedWriter
+	if options.encryptionKey != nil {
+		contentWriter = cipher.StreamWriter{S: options.encryptionKey.Stream(0), W: verifiedWriter}
+	}
+	writers := []io.Writer{sha512SumGenerator, contentWriter}
+	for _, digestHash := range digestHashes {
+		if digestHash != sha512SumGenerator {
+			writers = append(writers, digestHash)
+		}
+	}
+	multiWriter := io.MultiWriter(writers...)
 
+	copyResult := make(chan error, 1)
 	go func() {
 		copySpan := handlerMainSpan.StartChild("object.copy")
 		defer copySpan.Finish()
-		_, err := io.CopyN(multiWriter, r.Body, r.ContentLength)
-		pipeWriter.CloseWithError(err)
+		_, err := io.Copy(multiWriter, body)
+		// content corrupted on its way never becomes complete in the storage
+		if err == nil {
+			err = options.digests.verify(digestHashes)
+		}
+		verifiedWriter.close(err)
+		copyResult <- err
 	}()
 
 	objectForwardSpan := handlerMainSpan.StartChild("object.put")
+	defer objectForwardSpan.Finish()
 
-	prefixId := uuid.NewString()
-
-	uploadedObject, uploadError := c.minioClient.PutObject(objectForwardSpan.Context(), p.S3BucketName, prefixId+"/"+filename, pipeReader, r.ContentLength, minio.PutObjectOptions{
-		ContentType: selectContentType(filename),
+	uploadedObject, uploadError := c.storage.Put(objectForwardSpan.Context(), id+"/"+filename, pipeReader, size, storage.PutOptions{
+		ContentType:  contentType,
+		UserMetadata: metadata,
 	})
+	// unblock the copy routine if the backend stopped reading early
+	pipeReader.CloseWithError(uploadError)
 
+	var maxBytesError *http.MaxBytesError
+	copyError := <-copyResult
+	if errors.As(copyError, &maxBytesError) {
+		sentry.CaptureMessage("upload too large")
+		objectForwardSpan.Status = sentry.SpanStatusInvalidArgument
+		return uploadResult{}, copyError
+	}
+	if errors.Is(copyError, errChecksumMismatch) {
+		objectForwardSpan.Status = sentry.SpanStatusInvalidArgument
+		return uploadResult{}, copyError
+	}
 	if uploadError != nil {
-		traceLog(c.logger, uploadError)
-		sentry.CaptureException(uploadError)
 		objectForwardSpan.Status = sentry.SpanStatusInternalError
-		w.WriteHeader(minio.ToErrorResponse(uploadError).StatusCode)
-		return
+		return uploadResult{}, uploadError
 	}
 
 	metadata[ChecksumMetadataFieldName] = hex.EncodeToString(sha512SumGenerator.Sum(nil))
 	objectMetadataSpan := handlerMainSpan.StartChild("object.put.metadata")
-	_, copyError := c.minioClient.CopyObject(objectMetadataSpan.Context(), minio.CopyDestOptions{
-		Bucket:          p.S3BucketName,
-		Object:          uploadedObject.Key,
-		UserMetadata:    metadata,
-		ReplaceMetadata: true,
-	}, minio.CopySrcOptions{
-		Bucket: uploadedObject.Bucket,
-		Object: uploadedObject.Key,
-	})
+	metadataError := c.storage.SetMetadata(objectMetadataSpan.Context(), uploadedObject.Key, metadata)
 	objectMetadataSpan.Finish()
-	if copyError != nil {
-		traceLog(c.logger, copyError)
-		sentry.CaptureException(copyError)
+	if metadataError != nil {
 		objectForwardSpan.Status = sentry.SpanStatusInternalError
-		w.WriteHeader(minio.ToErrorResponse(copyError).StatusCode)
+		return uploadResult{}, metadataError
+	}
+
+	c.recordUpload(options, uploadedObject.Size)
+
+	return uploadResult{
+		ID:               id,
+		Filename:         filename,
+		OriginalFilename: cmp.Or(options.originalFilename, filename),
+		URL:              c.signedDownloadLink(r, id, filename, options.expiry, options.encryptionKey),
+		Size:             uploadedObject.Size,
+		ContentType:      contentType,
+		Sha512:           metadata[ChecksumMetadataFieldName],
+		Expiry:           options.expiry,
+		MaxDownloads:     options.maxDownloads,
+		ListURL:          c.signedListLink(r, id, options.expiry),
+		DeleteURL:        deleteLink(downloadLink(r, id, filename), options.deletionToken),
+		Encryption:       options.clientEncryption,
+	}, nil
+}
+
+func (c *Config) UploadHandler(w http.ResponseWriter, r *http.Request) {
+	handlerMainSpan := sentry.StartSpan(r.Context(), "handler.upload")
+	defer handlerMainSpan.Finish()
+
+	vars := mux.Vars(r)
+	filename, ok := vars["filename"]
+	filename = sanitizeFilename(filename)
+
+	if cancelRequestIfUnhealthy(w) {
+		return
+	}
+
+	if !ok || filename == "" {
+		http.Error(w, "filename not provided", http.StatusBadRequest)
+		return
+	}
+	options, err := parseUploadOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	options.originalFilename = displayFilename(vars["filename"])
+	if options.digests, err = parseExpectedDigests(r.Header); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	objectForwardSpan.Finish()
+	// PUT /{id}/{filename} adds a file to the files already uploaded with that id
+	id, addToExisting := vars["id"]
+	if addToExisting {
+		// parallel uploads of the same file would all pass the check otherwise
+		unlock := c.uploadLocks.lock(id + "/" + filename)
+		defer unlock()
+		if status := c.checkAddableToUpload(r, id, filename); status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		// the whole upload stays deletable with the token used to add to it
+		if token := requestDeletionToken(r); token != "" {
+			options.deletionToken = token
+		}
+	} else {
+		id = uuid.NewString()
+	}
 
-	metrics.ObjectSize.Observe(float64(r.ContentLength))
-	metrics.ObjectAction.With(prometheus.Labels{metrics.LabelAction: "upload"}).Inc()
+	// the limit is lowered by the remaining quota of authenticated uploaders
+	reservation, status := c.reserveQuota(r.Context(), r.ContentLength)
+	if status != http.StatusOK {
+		writeQuotaError(w, status)
+		return
+	}
+	// bodies of unknown length (chunked transfer encoding) are checked against the limit while reading
+	body := http.MaxBytesReader(w, r.Body, reservation.limit)
 
-	downloadLink := fmt.Sprintf("%s://%s/%s/%s\n", p.DownloadLinkPrefix, r.Host, prefixId, filename)
+	result, uploadError := c.storeUpload(handlerMainSpan, r, id, filename, body, r.ContentLength, options)
+	if uploadError != nil {
+		c.releaseQuota(reservation)
+		traceLog(c.logger, uploadError)
+		sentry.CaptureException(uploadError)
+		http.Error(w, uploadErrorMessage(uploadError), uploadErrorStatusCode(uploadError))
+		return
+	}
+	c.commitQuota(reservation, result.Size)
 
-	// generate download link
-	_, downloadLinkResponseError := fmt.Fprint(w, downloadLink)
+	options.setResponseHeaders(w)
+	w.Header().Set(deleteLinkHeader, result.DeleteURL)
+	w.Header().Set(listLinkHeader, result.ListURL)
 	handlerMainSpan.Data = map[string]interface{}{
-		"download_link": downloadLink,
+		"download_link": result.URL,
 	}
-	if downloadLinkResponseError != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	// curl users get the bare download link, tools may ask for the full description
+	if responseError := writeNegotiatedResponse(w, r, result, uploadResults{result}.writeLinks); responseError != nil {
+		traceLog(c.logger, responseError)
+	}
+}
+
+// FormUploadHandler - store all files of a multipart/form-data request under one common id
+func (c *Config) FormUploadHandler(w http.ResponseWriter, r *http.Request) {
+	handlerMainSpan := sentry.StartSpan(r.Context(), "handler.upload.form")
+	defer handlerMainSpan.Finish()
+
+	if cancelRequestIfUnhealthy(w) {
+		return
+	}
+	limit := p.UploadLimitGB * metrics.GB
+	if r.ContentLength > limit {
+		sentry.CaptureMessage("upload too large")
+		http.Error(w, "upload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	options, err := parseUploadOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+
+	// the limit applies to the sum of all files, the quota of authenticated uploaders to every single file
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	multipartReader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "multipart/form-data body expected", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	id := uuid.NewString()
+	var results uploadResults
+	// remove already stored files of this request if a later one fails
+	discardResults := func() {
+		for _, result := range results {
+			if err := c.storage.Delete(context.Background(), id+"/"+result.Filename); err != nil {
+				traceLog(c.logger, err)
+				continue
+			}
+			c.releaseStoredQuota(options.uploader, result.Size)
+		}
+	}
+
+	for {
+		part, err := multipartReader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			discardResults()
+			http.Error(w, "invalid multipart body", uploadErrorStatusCode(err))
+			return
+		}
+		filename := sanitizeFilename(part.FileName())
+		if filename == "" {
+			// skip form fields which are not files
+			continue
+		}
+		// parts stored under the same name would overwrite each other, e.g. "März.txt" and "Marz.txt"
+		if slices.ContainsFunc(results, func(result uploadResult) bool { return result.Filename == filename }) {
+			discardResults()
+			http.Error(w, "duplicate filename "+filename, http.StatusConflict)
+			return
+		}
+		options.originalFilename = displayFilename(part.FileName())
+		// every file gets its own key, encrypting two files with the same ctr keystream would leak their plaintexts
+		if options.encryptionKey != nil {
+			key := encryption.NewKey()
+			options.encryptionKey = &key
+		}
+		// parts may announce the checksums of their content
+		if options.digests, err = parseExpectedDigests(http.Header(part.Header)); err != nil {
+			discardResults()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reservation, status := c.reserveQuota(r.Context(), -1)
+		if status != http.StatusOK {
+			discardResults()
+			writeQuotaError(w, status)
+			return
+		}
+		result, uploadError := c.storeUpload(handlerMainSpan, r, id, filename, http.MaxBytesReader(w, part, reservation.limit), -1, options)
+		if uploadError != nil {
+			c.releaseQuota(reservation)
+			traceLog(c.logger, uploadError)
+			sentry.CaptureException(uploadError)
+			discardResults()
+			http.Error(w, uploadErrorMessage(uploadError), uploadErrorStatusCode(uploadError))
+			return
+		}
+		c.commitQuota(reservation, result.Size)
+		results = append(results, result)
+	}
+
+	if len(results) == 0 {
+		http.Error(w, "no file provided", http.StatusBadRequest)
+		return
+	}
+
+	options.setResponseHeaders(w)
+	for _, result := range results {
+		w.Header().Add(deleteLinkHeader, result.DeleteURL)
+	}
+	w.Header().Set(listLinkHeader, results[0].ListURL)
+	if responseError := writeNegotiatedResponse(w, r, results, results.writeLinks); responseError != nil {
+		traceLog(c.logger, responseError)
+	}
 }
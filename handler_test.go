@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"transfer/internal/storage"
+)
+
+// newTestServer - application server backed by the memory storage backend
+func newTestServer(t *testing.T) (*httptest.Server, *Config) {
+	t.Helper()
+	p = Parameters{
+		DownloadLinkPrefix: "http",
+		UploadLimitGB:      1,
+		TusExpiration:      time.Hour,
+		RetentionDefault:   time.Hour,
+		RetentionMin:       time.Minute,
+		RetentionMax:       7 * 24 * time.Hour,
+		InlineTypes:        defaultInlineTypes,
+	}
+	backendState = StateHealthy
+	t.Cleanup(func() { backendState = StateUnhealthy })
+
+	c := &Config{storage: storage.NewMemory(0)}
+	server := httptest.NewServer(c.applicationRouter())
+	t.Cleanup(server.Close)
+	return server, c
+}
+
+// mustRequest - create a request or fail the test
+func mustRequest(t *testing.T, method string, url string, body io.Reader) *http.Request {
+	t.Helper()
+	request, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
+
+// doRequest - perform request and return status code and body
+func doRequest(t *testing.T, method string, url string, body io.Reader) (int, string) {
+	t.Helper()
+	response, err := http.DefaultClient.Do(mustRequest(t, method, url, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, string(content)
+}
+
+func TestUploadDownloadFlow(t *testing.T) {
+	server, _ := newTestServer(t)
+	const content = "hello transfer"
+
+	status, link := doRequest(t, http.MethodPut, server.URL+"/hello.txt", strings.NewReader(content))
+	if status != http.StatusOK {
+		t.Fatalf("upload failed with status %d: %s", status, link)
+	}
+	link = strings.TrimSpace(link)
+	if !strings.HasPrefix(link, server.URL+"/") || !strings.HasSuffix(link, "/hello.txt") {
+		t.Fatalf("unexpected download link %+q", link)
+	}
+
+	status, downloaded := doRequest(t, http.MethodGet, link, nil)
+	if status != http.StatusOK || downloaded != content {
+		t.Errorf("download returned %d %+q", status, downloaded)
+	}
+
+	checksum := sha512.Sum512([]byte(content))
+	status, sum := doRequest(t, http.MethodGet, link+"/sum", nil)
+	if expected := hex.EncodeToString(checksum[:]) + "  hello.txt\n"; status != http.StatusOK || sum != expected {
+		t.Errorf("sum returned %d %+q, expected %+q", status, sum, expected)
+	}
+
+	status, _ = doRequest(t, http.MethodGet, server.URL+"/00000000-0000-0000-0000-000000000000/hello.txt", nil)
+	if status != http.StatusNotFound {
+		t.Errorf("missing file returned status %d", status)
+	}
+}
+
+func TestDownloadRangeAndConditionalRequests(t *testing.T) {
+	server, _ := newTestServer(t)
+	_, link := doRequest(t, http.MethodPut, server.URL+"/digits.txt", strings.NewReader("0123456789"))
+	link = strings.TrimSpace(link)
+
+	download := func(headers map[string]string) (*http.Response, string) {
+		request, _ := http.NewRequest(http.MethodGet, link, nil)
+		for key, value := range headers {
+			request.Header.Set(key, value)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		content, _ := io.ReadAll(response.Body)
+		return response, string(content)
+	}
+
+	full, _ := download(nil)
+	etag, lastModified := full.Header.Get("ETag"), full.Header.Get("Last-Modified")
+	if etag == "" || lastModified == "" || full.Header.Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("validators missing: %v", full.Header)
+	}
+
+	for _, test := range []struct {
+		Name            string
+		Headers         map[string]string
+		ExpectedStatus  int
+		ExpectedContent string
+	}{
+		{
+			Name:            "single range",
+			Headers:         map[string]string{"Range": "bytes=2-4"},
+			ExpectedStatus:  http.StatusPartialContent,
+			ExpectedContent: "234",
+		},
+		{
+			Name:            "resume from offset",
+			Headers:         map[string]string{"Range": "bytes=7-"},
+			ExpectedStatus:  http.StatusPartialContent,
+			ExpectedContent: "789",
+		},
+		{
+			Name:           "unsatisfiable range",
+			Headers:        map[string]string{"Range": "bytes=20-"},
+			ExpectedStatus: http.StatusRequestedRangeNotSatisfiable,
+		},
+		{
+			Name:           "matching etag",
+			Headers:        map[string]string{"If-None-Match": etag},
+			ExpectedStatus: http.StatusNotModified,
+		},
+		{
+			Name:           "not modified since",
+			Headers:        map[string]string{"If-Modified-Since": lastModified},
+			ExpectedStatus: http.StatusNotModified,
+		},
+		{
+			Name:            "outdated range condition",
+			Headers:         map[string]string{"Range": "bytes=2-4", "If-Range": `"outdated"`},
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: "0123456789",
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			response, content := download(test.Headers)
+			if response.StatusCode != test.ExpectedStatus || (test.ExpectedContent != "" && content != test.ExpectedContent) {
+				t.Errorf("status %d with %+q, expected %d with %+q", response.StatusCode, content, test.ExpectedStatus, test.ExpectedContent)
+			}
+		})
+	}
+
+	response, content := download(map[string]string{"Range": "bytes=0-1,8-9"})
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if response.StatusCode != http.StatusPartialContent || mediaType != "multipart/byteranges" {
+		t.Fatalf("multi range returned %d %+q", response.StatusCode, mediaType)
+	}
+	if !strings.Contains(content, "01") || !strings.Contains(content, "89") {
+		t.Errorf("multi range response misses parts: %+q", content)
+	}
+}
+
+func TestChunkedUpload(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	// the client uses chunked transfer encoding for readers of unknown length
+	body := io.MultiReader(strings.NewReader("streamed "), strings.NewReader("content"))
+	status, link := doRequest(t, http.MethodPut, server.URL+"/stream.txt", body)
+	if status != http.StatusOK {
+		t.Fatalf("upload failed with status %d: %s", status, link)
+	}
+
+	status, downloaded := doRequest(t, http.MethodGet, strings.TrimSpace(link), nil)
+	if status != http.StatusOK || downloaded != "streamed content" {
+		t.Errorf("download returned %d %+q", status, downloaded)
+	}
+}
+
+func TestFormUpload(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for filename, content := range map[string]string{"a.txt": "first", "b.txt": "second"} {
+		part, _ := form.CreateFormFile("file", filename)
+		part.Write([]byte(content))
+	}
+	form.WriteField("comment", "not a file")
+	form.Close()
+
+	request, _ := http.NewRequest(http.MethodPost, server.URL+"/", &body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	request.Header.Set("Accept", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var results []uploadResult
+	if err := json.NewDecoder(response.Body).Decode(&results); err != nil {
+		t.Fatalf("status %d: %v", response.StatusCode, err)
+	}
+	if len(results) != 2 || results[0].ID != results[1].ID {
+		t.Fatalf("expected two files with a common id: %+v", results)
+	}
+	for _, result := range results {
+		status, downloaded := doRequest(t, http.MethodGet, result.URL, nil)
+		if status != http.StatusOK || int64(len(downloaded)) != result.Size {
+			t.Errorf("download of %+q returned %d %+q", result.Filename, status, downloaded)
+		}
+	}
+}
+
+func TestFormUploadDuplicateFilenames(t *testing.T) {
+	server, c := newTestServer(t)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, filename := range []string{"März.txt", "Marz.txt"} {
+		part, _ := form.CreateFormFile("file", filename)
+		part.Write([]byte(filename))
+	}
+	form.Close()
+
+	request := mustRequest(t, http.MethodPost, server.URL+"/", &body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusConflict {
+		t.Errorf("upload of files with the same name returned %d", response.StatusCode)
+	}
+	for object, err := range c.storage.List(context.Background(), "") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Errorf("object %+q of the rejected upload was kept", object.Key)
+	}
+}
+
+func TestUploadRejectedWhileUnhealthy(t *testing.T) {
+	server, _ := newTestServer(t)
+	backendState = StateUnhealthy
+
+	status, _ := doRequest(t, http.MethodPut, server.URL+"/hello.txt", strings.NewReader("content"))
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d but got %d", http.StatusServiceUnavailable, status)
+	}
+}
+
+func TestJSONResponses(t *testing.T) {
+	server, _ := newTestServer(t)
+	const content = "negotiated"
+	sum := sha512.Sum512([]byte(content))
+
+	request := mustRequest(t, http.MethodPut, server.URL+"/data.txt", strings.NewReader(content))
+	request.Header.Set("Accept", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var uploaded uploadResult
+	if err := json.NewDecoder(response.Body).Decode(&uploaded); err != nil {
+		t.Fatalf("status %d: %v", response.StatusCode, err)
+	}
+	if uploaded.Filename != "data.txt" || uploaded.Size != int64(len(content)) || uploaded.Sha512 != hex.EncodeToString(sum[:]) || uploaded.DeleteURL == "" {
+		t.Errorf("unexpected upload result %+v", uploaded)
+	}
+
+	tests := []struct {
+		Name     string
+		Accept   string
+		Expected string
+	}{
+		{Name: "text", Accept: "", Expected: "text/plain; charset=utf-8"},
+		{Name: "curl default", Accept: "*/*", Expected: "text/plain; charset=utf-8"},
+		{Name: "json", Accept: "application/json", Expected: "application/json"},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			request := mustRequest(t, http.MethodGet, uploaded.URL+"/sum", nil)
+			request.Header.Set("Accept", test.Accept)
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			body, _ := io.ReadAll(response.Body)
+			if contentType := response.Header.Get("Content-Type"); contentType != test.Expected {
+				t.Fatalf("expected content type %+q, got %+q", test.Expected, contentType)
+			}
+			if !strings.Contains(string(body), hex.EncodeToString(sum[:])) {
+				t.Errorf("checksum missing in %+q", body)
+			}
+		})
+	}
+}
+
+func TestInfo(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	request := mustRequest(t, http.MethodPut, server.URL+"/info.txt", strings.NewReader("described"))
+	request.Header.Set("Max-Downloads", "3")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+
+	status, text := doRequest(t, http.MethodGet, strings.TrimSpace(string(link))+"/info", nil)
+	if status != http.StatusOK || !strings.Contains(text, "remaining downloads: 3") || !strings.Contains(text, "size:                9 (9 B)") {
+		t.Errorf("text info returned %d:\n%s", status, text)
+	}
+
+	request = mustRequest(t, http.MethodGet, strings.TrimSpace(string(link))+"/info", nil)
+	request.Header.Set("Accept", "application/json")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var info uploadResult
+	if err := json.NewDecoder(response.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 9 || info.MaxDownloads != 3 || info.Uploaded.IsZero() || info.ContentType != "text/plain; charset=utf-8" {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	// describing a file does not count as download
+	if status, body := doRequest(t, http.MethodGet, strings.TrimSpace(string(link))+"/info", nil); status != http.StatusOK || !strings.Contains(body, "remaining downloads: 3") {
+		t.Errorf("info counted as download: %d\n%s", status, body)
+	}
+}
+
+func TestUnicodeFilename(t *testing.T) {
+	server, _ := newTestServer(t)
+	const filename = "Bericht März (final).txt"
+
+	request := mustRequest(t, http.MethodPut, server.URL+"/"+url.PathEscape(filename), strings.NewReader("report"))
+	request.Header.Set("Accept", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var uploaded uploadResult
+	if err := json.NewDecoder(response.Body).Decode(&uploaded); err != nil {
+		t.Fatal(err)
+	}
+	if uploaded.Filename != "Bericht_Marz_final.txt" || uploaded.OriginalFilename != filename || !strings.HasSuffix(uploaded.URL, "/Bericht_Marz_final.txt") {
+		t.Fatalf("unexpected upload result %+v", uploaded)
+	}
+
+	download, err := http.Get(uploaded.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	download.Body.Close()
+	_, parameters, err := mime.ParseMediaType(download.Header.Get("Content-Disposition"))
+	if err != nil || parameters["filename"] != filename {
+		t.Errorf("download named %+q: %v", download.Header.Get("Content-Disposition"), err)
+	}
+}
+
+// unreadableBackend - storage failing to deliver the content of existing objects
+type unreadableBackend struct {
+	storage.Backend
+}
+
+func (u unreadableBackend) Get(context.Context, string) (io.ReadSeekCloser, error) {
+	return nil, errors.New("backend unavailable")
+}
+
+func TestDownloadStorageError(t *testing.T) {
+	server, c := newTestServer(t)
+	_, link := doRequest(t, http.MethodPut, server.URL+"/digits.txt", strings.NewReader("0123456789"))
+	link = strings.TrimSpace(link)
+	c.storage = unreadableBackend{c.storage}
+
+	if status, _ := doRequest(t, http.MethodGet, link, nil); status != http.StatusInternalServerError {
+		t.Errorf("download returned %d instead of an error", status)
+	}
+
+	// conditional requests only open the object if content is sent, failures abort the response
+	request := mustRequest(t, http.MethodGet, link, nil)
+	request.Header.Set("If-None-Match", `"outdated"`)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if _, err := io.ReadAll(response.Body); err == nil {
+		t.Errorf("failed download completed with status %d", response.StatusCode)
+	}
+}
@@ -1,12 +1,25 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"mime"
 	"net/http"
+	"net/url"
 	"path"
 	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"transfer/internal/storage"
 )
 
 // selectContentType - parse file extension and determine content type
@@ -16,7 +29,10 @@ func selectContentType(filename string) string {
 		// return default if no file extension is found
 		return "application/octet-stream"
 	}
-	return mime.TypeByExtension(extension)
+	if contentType := mime.TypeByExtension(extension); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
 }
 
 // cancelRequestIfUnhealthy - action not possible due to broken backend
@@ -28,6 +44,92 @@ func cancelRequestIfUnhealthy(w http.ResponseWriter) bool {
 	return false
 }
 
+// storageErrorStatusCode - map errors returned by the storage backend to http status codes
+func storageErrorStatusCode(err error) int {
+	if errors.Is(err, storage.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// lazyObjectReader - io.ReadSeekCloser of known size opening the underlying object only once content is read
+type lazyObjectReader struct {
+	open   func() (io.ReadSeekCloser, error)
+	size   int64
+	offset int64
+	reader io.ReadSeekCloser
+	// read - whether content was read
+	read bool
+	// err - first error returned by the underlying object
+	err error
+}
+
+// contentRead - whether content of the underlying object was read
+func (l *lazyObjectReader) contentRead() bool {
+	return l.read
+}
+
+// prepare - open the underlying object without reading it, e.g. to report storage errors before a response is sent
+func (l *lazyObjectReader) prepare() error {
+	if l.err != nil || l.reader != nil {
+		return l.err
+	}
+	if l.reader, l.err = l.open(); l.err != nil {
+		return l.err
+	}
+	_, l.err = l.reader.Seek(l.offset, io.SeekStart)
+	return l.err
+}
+
+func (l *lazyObjectReader) Read(b []byte) (int, error) {
+	if err := l.prepare(); err != nil {
+		return 0, err
+	}
+	l.read = true
+	n, err := l.reader.Read(b)
+	l.offset += int64(n)
+	if err != nil && err != io.EOF {
+		l.err = err
+	}
+	return n, err
+}
+
+func (l *lazyObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += l.offset
+	case io.SeekEnd:
+		offset += l.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if l.reader != nil {
+		if _, err := l.reader.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	l.offset = offset
+	return offset, nil
+}
+
+func (l *lazyObjectReader) Close() error {
+	if l.reader == nil {
+		return nil
+	}
+	return l.reader.Close()
+}
+
+// conditionalRequest - whether r may be answered without content, e.g. with 304 Not Modified
+func conditionalRequest(r *http.Request) bool {
+	for _, header := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range"} {
+		if r.Header.Get(header) != "" {
+			return true
+		}
+	}
+	return false
+}
+
 // traceLog - logs msg to logger with detailed information about location in code. If logger is set to nil, the default logger will be used
 func traceLog(logger *log.Logger, msg interface{}) {
 	if logger == nil {
@@ -41,7 +143,197 @@ func traceLog(logger *log.Logger, msg interface{}) {
 	}
 }
 
+// filenameTransliterations - letters without a decomposition into a base letter and accents
+var filenameTransliterations = strings.NewReplacer(
+	"ß", "ss", "Æ", "AE", "æ", "ae", "Œ", "OE", "œ", "oe", "Ø", "O", "ø", "o", "Ł", "L", "ł", "l", "Đ", "D", "đ", "d",
+	"Þ", "TH", "þ", "th",
+)
+
+// cleanFilename - client supplied filename without directories, invalid encoding, control characters and format
+// characters; the latter include bidi overrides disguising extensions like "invoice\u202Efdp.exe"
+func cleanFilename(filename string) string {
+	filename = strings.ToValidUTF8(filename, "")
+	filename = filename[strings.LastIndexAny(filename, `/\`)+1:]
+	filename = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, filename)
+	return strings.TrimSpace(filename)
+}
+
+// displayFilename - client supplied filename as shown to downloaders, empty if it only refers to a directory like
+// ".."; those files are named by their slug
+func displayFilename(filename string) string {
+	filename = cleanFilename(filename)
+	if filename == "." || filename == ".." {
+		return ""
+	}
+	return filename
+}
+
+// sanitizeFilename - reduce a client supplied filename to an ascii slug safe for object keys and urls, e.g.
+// "Bericht März (final).pdf" to "Bericht_Marz_final.pdf"
+func sanitizeFilename(filename string) string {
+	filename = cleanFilename(filename)
+	if filename == "" {
+		return ""
+	}
+	// names made only of dots like ".." refer to directories and have no extension to keep
+	if strings.Trim(filename, ".") == "" {
+		return "file"
+	}
+	var slug strings.Builder
+	for _, r := range norm.NFKD.String(filenameTransliterations.Replace(filename)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// accents separated from their letters by the decomposition
+		case unicode.IsSpace(r):
+			slug.WriteByte('_')
+		default:
+			slug.WriteRune(r)
+		}
+	}
+	sanitized := onlyAllowedCharacters(slug.String())
+	// names without any latin letters or digits, e.g. in cyrillic script, keep their extension
+	if strings.Trim(strings.TrimSuffix(sanitized, path.Ext(sanitized)), "._-") == "" {
+		return "file" + path.Ext(sanitized)
+	}
+	return sanitized
+}
+
+// encodeFilenameMetadata - filename as ascii metadata value; s3 only transfers ascii metadata reliably
+func encodeFilenameMetadata(filename string) string {
+	return url.PathEscape(filename)
+}
+
+// objectFilename - filename given by the uploader of object, the name of its key for objects stored without it
+func objectFilename(object storage.Object) string {
+	if filename, err := url.PathUnescape(object.UserMetadata[OriginalFilenameMetadataFieldName]); err == nil && displayFilename(filename) != "" {
+		return displayFilename(filename)
+	}
+	return path.Base(object.Key)
+}
+
+// contentDisposition - Content-Disposition header with the ascii fallback for old clients and the utf-8 filename as
+// described by RFC 6266 and RFC 5987. The fallback may only contain characters allowed in object keys.
+func contentDisposition(disposition string, filename string, fallback string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(filename) {
+		// attr-char of RFC 5987
+		if 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || strings.IndexByte("!#$&+-.^_`|~", b) >= 0 {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, fallback, encoded.String())
+}
+
+// downloadLink - absolute link for downloading the object stored as <id>/<filename>
+func downloadLink(r *http.Request, id string, filename string) string {
+	return fmt.Sprintf("%s://%s/%s/%s", p.DownloadLinkPrefix, r.Host, id, filename)
+}
+
+// writeNegotiatedResponse - write value as json if the client prefers it, otherwise the text representation
+func writeNegotiatedResponse(w http.ResponseWriter, r *http.Request, value any, text func(io.Writer) error) error {
+	w.Header().Add("Vary", "Accept")
+	switch negotiateContentType(r, "text/plain", "application/json") {
+	case "application/json":
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(value)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		return text(w)
+	}
+}
+
+// negotiateContentType - select the offer preferred by the Accept header of r. The first offer is used if the
+// header is missing or accepts none of the offers.
+func negotiateContentType(r *http.Request, offers ...string) string {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offers[0]
+	}
+
+	selected, selectedQuality := offers[0], 0.0
+	for _, offer := range offers {
+		offerType, _, _ := strings.Cut(offer, "/")
+		// quality of the most specific media range matching the offer
+		quality, specificity := 0.0, -1
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, parameters, _ := strings.Cut(mediaRange, ";")
+			mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+			rangeSpecificity := -1
+			switch mediaType {
+			case offer:
+				rangeSpecificity = 2
+			case offerType + "/*":
+				rangeSpecificity = 1
+			case "*/*":
+				rangeSpecificity = 0
+			}
+			if rangeSpecificity <= specificity {
+				continue
+			}
+			specificity, quality = rangeSpecificity, 1.0
+			for _, parameter := range strings.Split(parameters, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(parameter), "=")
+				if key == "q" {
+					if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+						quality = parsed
+					}
+				}
+			}
+		}
+		if quality > selectedQuality {
+			selected, selectedQuality = offer, quality
+		}
+	}
+	return selected
+}
+
 func onlyAllowedCharacters(s string) string {
 	gex := regexp.MustCompile(`[^a-zA-Z.0-9_-]`)
 	return gex.ReplaceAllString(s, "")
 }
+
+// keyedMutex - mutual exclusion of operations on the same key
+type keyedMutex struct {
+	mutex sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock - mutex of one key and the number of goroutines holding or waiting for it
+type keyedLock struct {
+	sync.Mutex
+	users int
+}
+
+// lock - acquire the mutex of key and return the function releasing it
+func (k *keyedMutex) lock(key string) func() {
+	k.mutex.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		k.locks[key] = lock
+	}
+	lock.users++
+	k.mutex.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		k.mutex.Lock()
+		// forget the mutexes of keys nobody is waiting for
+		if lock.users--; lock.users == 0 {
+			delete(k.locks, key)
+		}
+		k.mutex.Unlock()
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"mime"
+	"net/http"
 	"testing"
 )
 
@@ -22,6 +24,11 @@ func TestSelectContentType(t *testing.T) {
 			ExpectedType:     "text/txt",
 			ExpectDifference: true,
 		},
+		{
+			Name:         "unknown extension",
+			Filename:     "test.unknown-extension",
+			ExpectedType: "application/octet-stream",
+		},
 	} {
 		t.Run(test.Name, func(t *testing.T) {
 			result := selectContentType(test.Filename)
@@ -67,3 +74,176 @@ func Test_onlyAllowedCharacters(t *testing.T) {
 		})
 	}
 }
+
+func Test_sanitizeFilename(t *testing.T) {
+	for _, test := range []struct {
+		Name     string
+		Filename string
+		Expected string
+	}{
+		{
+			Name:     "ascii",
+			Filename: "test-1.txt",
+			Expected: "test-1.txt",
+		},
+		{
+			Name:     "accents and spaces",
+			Filename: "Bericht März (final).pdf",
+			Expected: "Bericht_Marz_final.pdf",
+		},
+		{
+			Name:     "transliterated letters",
+			Filename: "Straße.txt",
+			Expected: "Strasse.txt",
+		},
+		{
+			Name:     "directories",
+			Filename: `C:\Users\test/../report.csv`,
+			Expected: "report.csv",
+		},
+		{
+			Name:     "non latin script",
+			Filename: "отчёт.pdf",
+			Expected: "file.pdf",
+		},
+		{
+			Name:     "bidi override",
+			Filename: "invoice\u202Efdp.exe",
+			Expected: "invoicefdp.exe",
+		},
+		{
+			Name:     "parent directory",
+			Filename: "..",
+			Expected: "file",
+		},
+		{
+			Name:     "only dots",
+			Filename: "dir/...",
+			Expected: "file",
+		},
+		{
+			Name:     "empty",
+			Filename: " ",
+			Expected: "",
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			result := sanitizeFilename(test.Filename)
+			if result != test.Expected {
+				t.Errorf("%+q is expected but %+q is resulting\n", test.Expected, result)
+			}
+		})
+	}
+}
+
+func Test_displayFilename(t *testing.T) {
+	for _, test := range []struct {
+		Name     string
+		Filename string
+		Expected string
+	}{
+		{
+			Name:     "unicode",
+			Filename: "Bericht März (final).pdf",
+			Expected: "Bericht März (final).pdf",
+		},
+		{
+			Name:     "directories",
+			Filename: "../../etc/passwd",
+			Expected: "passwd",
+		},
+		{
+			Name:     "control characters",
+			Filename: "report\r\n.csv",
+			Expected: "report.csv",
+		},
+		{
+			Name:     "bidi override",
+			Filename: "invoice\u202Efdp.exe",
+			Expected: "invoicefdp.exe",
+		},
+		{
+			Name:     "zero width space",
+			Filename: "re\u200Bport.csv",
+			Expected: "report.csv",
+		},
+		{
+			Name:     "parent directory",
+			Filename: "..",
+			Expected: "",
+		},
+		{
+			Name:     "current directory",
+			Filename: "a/.",
+			Expected: "",
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			result := displayFilename(test.Filename)
+			if result != test.Expected {
+				t.Errorf("%+q is expected but %+q is resulting\n", test.Expected, result)
+			}
+		})
+	}
+}
+
+func Test_contentDisposition(t *testing.T) {
+	const filename = "Bericht März (final).pdf"
+	header := contentDisposition("attachment", filename, "Bericht_Marz_final.pdf")
+	if expected := `attachment; filename="Bericht_Marz_final.pdf"; filename*=UTF-8''Bericht%20M%C3%A4rz%20%28final%29.pdf`; header != expected {
+		t.Errorf("%+q is expected but %+q is resulting", expected, header)
+	}
+	disposition, parameters, err := mime.ParseMediaType(header)
+	if err != nil || disposition != "attachment" || parameters["filename"] != filename {
+		t.Errorf("header parsed as %+q %+q: %v", disposition, parameters, err)
+	}
+}
+
+func Test_negotiateContentType(t *testing.T) {
+	for _, test := range []struct {
+		Name     string
+		Accept   string
+		Expected string
+	}{
+		{
+			Name:     "no accept header",
+			Expected: "text/plain",
+		},
+		{
+			Name:     "curl default",
+			Accept:   "*/*",
+			Expected: "text/plain",
+		},
+		{
+			Name:     "json requested",
+			Accept:   "application/json",
+			Expected: "application/json",
+		},
+		{
+			Name:     "json preferred by quality",
+			Accept:   "text/plain;q=0.5, application/json",
+			Expected: "application/json",
+		},
+		{
+			Name:     "wildcard subtype",
+			Accept:   "application/*",
+			Expected: "application/json",
+		},
+		{
+			Name:     "nothing acceptable",
+			Accept:   "image/png",
+			Expected: "text/plain",
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodGet, "/", nil)
+			if test.Accept != "" {
+				request.Header.Set("Accept", test.Accept)
+			}
+			result := negotiateContentType(request, "text/plain", "application/json")
+			if result != test.Expected {
+				t.Errorf("%+q is expected but %+q is resulting\n", test.Expected, result)
+			}
+		})
+	}
+}
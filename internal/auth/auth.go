@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Duration - time.Duration read from strings like "72h" in the credentials file
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Credential - identity allowed to upload files together with its limits. Limits of 0 are unlimited.
+type Credential struct {
+	Name string `json:"name"`
+	// Token - secret for bearer authentication
+	Token string `json:"token,omitempty"`
+	// Username and Password - secrets for basic authentication
+	Username     string   `json:"username,omitempty"`
+	Password     string   `json:"password,omitempty"`
+	MaxBytes     int64    `json:"max_bytes,omitempty"`
+	MaxFiles     int      `json:"max_files,omitempty"`
+	MaxRetention Duration `json:"max_retention,omitempty"`
+}
+
+// Credentials - all identities allowed to upload
+type Credentials []Credential
+
+// Load - read credentials from a json file containing a list of Credential objects
+func Load(path string) (Credentials, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var credentials Credentials
+	if err := json.Unmarshal(content, &credentials); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	names := make(map[string]bool)
+	for index, credential := range credentials {
+		switch {
+		case credential.Name == "":
+			return nil, fmt.Errorf("credential %d has no name", index)
+		case names[credential.Name]:
+			return nil, fmt.Errorf("credential name %+q is used twice", credential.Name)
+		case credential.Token == "" && (credential.Username == "" || credential.Password == ""):
+			return nil, fmt.Errorf("credential %+q needs a token or username and password", credential.Name)
+		}
+		names[credential.Name] = true
+	}
+	return credentials, nil
+}
+
+// equal - constant time comparison of secrets
+func equal(given string, expected string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+// Authenticate - find the credential matching the bearer token or basic auth of the request
+func (c Credentials) Authenticate(r *http.Request) (Credential, bool) {
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		for _, credential := range c {
+			if equal(token, credential.Token) {
+				return credential, true
+			}
+		}
+		return Credential{}, false
+	}
+	if username, password, ok := r.BasicAuth(); ok {
+		for _, credential := range c {
+			if equal(username, credential.Username) && equal(password, credential.Password) {
+				return credential, true
+			}
+		}
+	}
+	return Credential{}, false
+}
+
+type contextKey struct{}
+
+// WithCredential - attach the authenticated credential to ctx
+func WithCredential(ctx context.Context, credential Credential) context.Context {
+	return context.WithValue(ctx, contextKey{}, credential)
+}
+
+// FromContext - credential attached by WithCredential
+func FromContext(ctx context.Context) (Credential, bool) {
+	credential, ok := ctx.Value(contextKey{}).(Credential)
+	return credential, ok
+}
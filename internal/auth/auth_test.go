@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	for _, test := range []struct {
+		Name        string
+		Content     string
+		ExpectError bool
+	}{
+		{
+			Name:    "token and basic auth",
+			Content: `[{"name": "ci", "token": "secret", "max_retention": "72h"}, {"name": "alice", "username": "alice", "password": "secret"}]`,
+		},
+		{
+			Name:        "missing secret",
+			Content:     `[{"name": "ci"}]`,
+			ExpectError: true,
+		},
+		{
+			Name:        "duplicate name",
+			Content:     `[{"name": "ci", "token": "a"}, {"name": "ci", "token": "b"}]`,
+			ExpectError: true,
+		},
+		{
+			Name:        "invalid duration",
+			Content:     `[{"name": "ci", "token": "a", "max_retention": "3 days"}]`,
+			ExpectError: true,
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "credentials.json")
+			if err := os.WriteFile(path, []byte(test.Content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if (err != nil) != test.ExpectError {
+				t.Errorf("unexpected error state: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	credentials := Credentials{
+		{Name: "ci", Token: "token", MaxRetention: Duration(time.Hour)},
+		{Name: "alice", Username: "alice", Password: "password"},
+	}
+	for _, test := range []struct {
+		Name     string
+		Prepare  func(r *http.Request)
+		Expected string
+	}{
+		{
+			Name:     "bearer token",
+			Prepare:  func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") },
+			Expected: "ci",
+		},
+		{
+			Name:     "basic auth",
+			Prepare:  func(r *http.Request) { r.SetBasicAuth("alice", "password") },
+			Expected: "alice",
+		},
+		{
+			Name:    "wrong password",
+			Prepare: func(r *http.Request) { r.SetBasicAuth("alice", "token") },
+		},
+		{
+			Name:    "token as basic auth password",
+			Prepare: func(r *http.Request) { r.SetBasicAuth("", "token") },
+		},
+		{
+			Name:    "anonymous",
+			Prepare: func(r *http.Request) {},
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodPut, "/file", nil)
+			test.Prepare(request)
+			credential, ok := credentials.Authenticate(request)
+			if ok != (test.Expected != "") || credential.Name != test.Expected {
+				t.Errorf("%+q is expected but %+q (%v) is resulting", test.Expected, credential.Name, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Package encryption encrypts stored files with AES-256-CTR using a random key per file. CTR mode keeps the size of
+// the content and allows decrypting from arbitrary offsets, which range requests rely on.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// KeySize - length of a key in bytes
+const KeySize = 32
+
+// ErrInvalidKey - the given string does not represent a key
+var ErrInvalidKey = errors.New("invalid encryption key")
+
+// Key - secret of a single file. The key is never reused, so the counter always starts at zero.
+type Key [KeySize]byte
+
+// NewKey - random key
+func NewKey() Key {
+	var key Key
+	rand.Read(key[:])
+	return key
+}
+
+// ParseKey - key from its String representation
+func ParseKey(value string) (Key, error) {
+	var key Key
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(decoded) != KeySize {
+		return key, ErrInvalidKey
+	}
+	copy(key[:], decoded)
+	return key, nil
+}
+
+// String - url safe representation of the key
+func (k Key) String() string {
+	return base64.RawURLEncoding.EncodeToString(k[:])
+}
+
+// Check - value identifying the key without revealing it, stored to reject wrong keys before decrypting
+func (k Key) Check() string {
+	sum := sha256.Sum256(append([]byte("transfer key check\n"), k[:]...))
+	return hex.EncodeToString(sum[:])
+}
+
+// Stream - keystream starting at offset of the content
+func (k Key) Stream(offset int64) cipher.Stream {
+	block, err := aes.NewCipher(k[:])
+	if err != nil {
+		// aes only rejects keys of invalid length
+		panic(err)
+	}
+	var counter [aes.BlockSize]byte
+	binary.BigEndian.PutUint64(counter[8:], uint64(offset/aes.BlockSize))
+	stream := cipher.NewCTR(block, counter[:])
+	// discard the keystream of the block part before offset
+	skip := make([]byte, offset%aes.BlockSize)
+	stream.XORKeyStream(skip, skip)
+	return stream
+}
+
+// reader - decrypting io.ReadSeekCloser
+type reader struct {
+	source io.ReadSeekCloser
+	key    Key
+	stream cipher.Stream
+}
+
+// NewReader - decrypt content read from source, which must be positioned at the start
+func NewReader(source io.ReadSeekCloser, key Key) io.ReadSeekCloser {
+	return &reader{source: source, key: key, stream: key.Stream(0)}
+}
+
+func (r *reader) Read(b []byte) (int, error) {
+	n, err := r.source.Read(b)
+	r.stream.XORKeyStream(b[:n], b[:n])
+	return n, err
+}
+
+func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	position, err := r.source.Seek(offset, whence)
+	if err != nil {
+		return position, err
+	}
+	r.stream = r.key.Stream(position)
+	return position, nil
+}
+
+func (r *reader) Close() error {
+	return r.source.Close()
+}
@@ -0,0 +1,50 @@
+package encryption
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+func TestReaderSeek(t *testing.T) {
+	key := NewKey()
+	plaintext := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 10)
+	ciphertext := make([]byte, len(plaintext))
+	key.Stream(0).XORKeyStream(ciphertext, plaintext)
+	if bytes.Equal(ciphertext, plaintext) {
+		t.Fatal("content not encrypted")
+	}
+
+	for _, offset := range []int64{0, 1, 15, 16, 17, 100, int64(len(plaintext))} {
+		reader := NewReader(nopSeekCloser{bytes.NewReader(ciphertext)}, key)
+		if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		decrypted, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, plaintext[offset:]) {
+			t.Errorf("offset %d: decrypted content differs", offset)
+		}
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key := NewKey()
+	parsed, err := ParseKey(key.String())
+	if err != nil || parsed != key {
+		t.Errorf("key does not survive round trip: %v", err)
+	}
+	for _, value := range []string{"", "short", key.String() + "A", "not base64 !!"} {
+		if _, err := ParseKey(value); err == nil {
+			t.Errorf("expected %+q to be rejected", value)
+		}
+	}
+}
@@ -17,6 +17,7 @@ const (
 	LabelEndpoint = "endpoint"
 	LabelStatus   = "status"
 	LabelAction   = "action"
+	LabelUploader = "uploader"
 )
 
 const (
@@ -49,6 +50,18 @@ var (
 		Help:      "Actions applied to objects",
 	}, []string{LabelAction})
 
+	UploaderBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploader_bytes_total",
+		Help:      "Uploaded bytes per authenticated uploader",
+	}, []string{LabelUploader})
+
+	UploaderObjects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploader_objects_total",
+		Help:      "Uploaded objects per authenticated uploader",
+	}, []string{LabelUploader})
+
 	OperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: namespace,
 		Name:      "operation_duration",
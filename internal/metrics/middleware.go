@@ -22,7 +22,8 @@ func ApiMiddleware(handler http.HandlerFunc, logger *log.Logger, endpointName st
 		duration := time.Since(start)
 		OperationDuration.With(prometheus.Labels{LabelEndpoint: endpointName}).Observe(duration.Seconds())
 
-		logger.Printf("%v %v %v", r.Method, r.RequestURI, duration)
+		// download links carry encryption keys and tokens
+		logger.Printf("%v %v %v", r.Method, RedactURL(r.RequestURI), duration)
 	}
 	return fn
 }
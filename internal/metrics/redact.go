@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// redacted - replacement of secrets in logged urls
+const redacted = "REDACTED"
+
+// keySegment - encryption key in front of the filename of download links, /{id}/{key}/{filename}
+var keySegment = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+
+// secretQueryParameters - query parameters granting access to files
+var secretQueryParameters = []string{"token", "password", "signature"}
+
+// secretHeaders - request headers granting access to files
+var secretHeaders = []string{"Authorization", "X-Deletion-Token", "X-Download-Password"}
+
+// RedactURL - url or request uri without encryption keys and secret query values, safe for logs and error reports
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return redacted
+	}
+	if segments := strings.Split(u.EscapedPath(), "/"); len(segments) >= 4 && keySegment.MatchString(segments[2]) {
+		segments[2] = redacted
+		u.RawPath = strings.Join(segments, "/")
+		u.Path, _ = url.PathUnescape(u.RawPath)
+	}
+	u.RawQuery = RedactQuery(u.RawQuery)
+	return u.String()
+}
+
+// RedactQuery - raw query with the values of secret parameters replaced
+func RedactQuery(rawQuery string) string {
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return redacted
+	}
+	changed := false
+	for _, name := range secretQueryParameters {
+		if query.Has(name) {
+			query.Set(name, redacted)
+			changed = true
+		}
+	}
+	if !changed {
+		return rawQuery
+	}
+	return query.Encode()
+}
+
+// RedactSentryEvent - remove the secrets of the request from events sent to sentry; usable as BeforeSend and
+// BeforeSendTransaction
+func RedactSentryEvent(event *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+	if method, path, found := strings.Cut(event.Transaction, " "); found {
+		event.Transaction = method + " " + RedactURL(path)
+	}
+	if event.Request != nil {
+		event.Request.URL = RedactURL(event.Request.URL)
+		event.Request.QueryString = RedactQuery(event.Request.QueryString)
+		for name := range event.Request.Headers {
+			for _, secret := range secretHeaders {
+				if strings.EqualFold(name, secret) {
+					event.Request.Headers[name] = redacted
+				}
+			}
+		}
+	}
+	return event
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactURL(t *testing.T) {
+	key := strings.Repeat("k", 43)
+	for _, test := range []struct {
+		Name     string
+		URL      string
+		Expected string
+	}{
+		{
+			Name:     "plain download",
+			URL:      "/id/file.txt",
+			Expected: "/id/file.txt",
+		},
+		{
+			Name:     "encryption key",
+			URL:      "/id/" + key + "/file.txt/info",
+			Expected: "/id/REDACTED/file.txt/info",
+		},
+		{
+			Name:     "filename with the length of a key",
+			URL:      "/id/" + key,
+			Expected: "/id/" + key,
+		},
+		{
+			Name:     "deletion token",
+			URL:      "/id/file.txt?token=secret&inline=1",
+			Expected: "/id/file.txt?inline=1&token=REDACTED",
+		},
+		{
+			Name:     "absolute url",
+			URL:      "https://example.com/id/" + key + "/file.txt?expires=1&signature=abc",
+			Expected: "https://example.com/id/REDACTED/file.txt?expires=1&signature=REDACTED",
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			if result := RedactURL(test.URL); result != test.Expected {
+				t.Errorf("%+q is expected but %+q is resulting", test.Expected, result)
+			}
+		})
+	}
+}
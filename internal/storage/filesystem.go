@@ -0,0 +1,379 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// filesystemMetadataDir - directory below the root holding one sidecar json file per object
+	filesystemMetadataDir = ".meta"
+	// filesystemTemporaryDir - directory below the root receiving uploads until they are complete
+	filesystemTemporaryDir = ".tmp"
+	// filesystemMetadataSuffix - file extension of the sidecar files
+	filesystemMetadataSuffix = ".json"
+)
+
+// filesystemMetadata - content of the sidecar file stored next to every object
+type filesystemMetadata struct {
+	ContentType  string            `json:"content_type"`
+	ETag         string            `json:"etag"`
+	UserMetadata map[string]string `json:"user_metadata"`
+}
+
+// Filesystem - Backend implementation storing objects in a local directory
+type Filesystem struct {
+	root string
+}
+
+// NewFilesystem - create a Backend storing objects below the directory root
+func NewFilesystem(root string) (*Filesystem, error) {
+	for _, directory := range []string{root, filepath.Join(root, filesystemMetadataDir), filepath.Join(root, filesystemTemporaryDir)} {
+		if err := os.MkdirAll(directory, 0o750); err != nil {
+			return nil, err
+		}
+	}
+	return &Filesystem{root: root}, nil
+}
+
+// paths - resolve key to the location of the object and its sidecar file
+func (f *Filesystem) paths(key string) (objectPath string, metadataPath string, err error) {
+	localKey := filepath.FromSlash(key)
+	if !filepath.IsLocal(localKey) || strings.HasPrefix(key, filesystemMetadataDir+"/") || strings.HasPrefix(key, filesystemTemporaryDir+"/") {
+		return "", "", fmt.Errorf("invalid object key %+q", key)
+	}
+	return filepath.Join(f.root, localKey), filepath.Join(f.root, filesystemMetadataDir, localKey+filesystemMetadataSuffix), nil
+}
+
+func (f *Filesystem) readMetadata(metadataPath string) (filesystemMetadata, error) {
+	var metadata filesystemMetadata
+	content, err := os.ReadFile(metadataPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return metadata, nil
+	}
+	if err != nil {
+		return metadata, err
+	}
+	return metadata, json.Unmarshal(content, &metadata)
+}
+
+// writeMetadata - atomically replace the sidecar file
+func (f *Filesystem) writeMetadata(metadataPath string, metadata filesystemMetadata) error {
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(metadataPath), 0o750); err != nil {
+		return err
+	}
+	temporaryFile, err := os.CreateTemp(filepath.Join(f.root, filesystemTemporaryDir), "meta-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporaryFile.Name())
+	if _, err := temporaryFile.Write(content); err != nil {
+		temporaryFile.Close()
+		return err
+	}
+	if err := temporaryFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporaryFile.Name(), metadataPath)
+}
+
+func (f *Filesystem) Put(_ context.Context, key string, reader io.Reader, size int64, opts PutOptions) (Object, error) {
+	objectPath, metadataPath, err := f.paths(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	temporaryFile, err := os.CreateTemp(filepath.Join(f.root, filesystemTemporaryDir), "upload-*")
+	if err != nil {
+		return Object{}, err
+	}
+	defer os.Remove(temporaryFile.Name())
+
+	etagGenerator := md5.New()
+	written, copyError := io.Copy(io.MultiWriter(temporaryFile, etagGenerator), reader)
+	closeError := temporaryFile.Close()
+	if copyError != nil {
+		return Object{}, copyError
+	}
+	if closeError != nil {
+		return Object{}, closeError
+	}
+	if size >= 0 && written != size {
+		return Object{}, fmt.Errorf("expected %d bytes but received %d: %w", size, written, io.ErrUnexpectedEOF)
+	}
+
+	metadata := filesystemMetadata{
+		ContentType:  opts.ContentType,
+		ETag:         hex.EncodeToString(etagGenerator.Sum(nil)),
+		UserMetadata: opts.UserMetadata,
+	}
+	if err := f.writeMetadata(metadataPath, metadata); err != nil {
+		return Object{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0o750); err != nil {
+		return Object{}, err
+	}
+	if err := os.Rename(temporaryFile.Name(), objectPath); err != nil {
+		return Object{}, err
+	}
+	return f.stat(key, objectPath, metadataPath)
+}
+
+func (f *Filesystem) stat(key string, objectPath string, metadataPath string) (Object, error) {
+	info, err := os.Stat(objectPath)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return Object{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return Object{}, err
+	}
+	metadata, err := f.readMetadata(metadataPath)
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  metadata.ContentType,
+		ETag:         metadata.ETag,
+		LastModified: info.ModTime(),
+		UserMetadata: metadata.UserMetadata,
+	}, nil
+}
+
+func (f *Filesystem) Stat(_ context.Context, key string) (Object, error) {
+	objectPath, metadataPath, err := f.paths(key)
+	if err != nil {
+		return Object{}, err
+	}
+	return f.stat(key, objectPath, metadataPath)
+}
+
+func (f *Filesystem) Get(_ context.Context, key string) (io.ReadSeekCloser, error) {
+	objectPath, _, err := f.paths(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(objectPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return file, err
+}
+
+func (f *Filesystem) SetMetadata(_ context.Context, key string, userMetadata map[string]string) error {
+	objectPath, metadataPath, err := f.paths(key)
+	if err != nil {
+		return err
+	}
+	if _, err := f.stat(key, objectPath, metadataPath); err != nil {
+		return err
+	}
+	metadata, err := f.readMetadata(metadataPath)
+	if err != nil {
+		return err
+	}
+	metadata.UserMetadata = userMetadata
+	return f.writeMetadata(metadataPath, metadata)
+}
+
+func (f *Filesystem) Delete(_ context.Context, key string) error {
+	objectPath, metadataPath, err := f.paths(key)
+	if err != nil {
+		return err
+	}
+	for _, filePath := range []string{objectPath, metadataPath} {
+		if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		// drop the id directory after its last file is gone
+		if directory := filepath.Dir(filePath); directory != f.root {
+			_ = os.Remove(directory)
+		}
+	}
+	return nil
+}
+
+func (f *Filesystem) List(ctx context.Context, prefix string) iter.Seq2[Object, error] {
+	return func(yield func(Object, error) bool) {
+		walkError := filepath.WalkDir(f.root, func(filePath string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctxError := ctx.Err(); ctxError != nil {
+				return ctxError
+			}
+			relativePath, err := filepath.Rel(f.root, filePath)
+			if err != nil {
+				return err
+			}
+			key := filepath.ToSlash(relativePath)
+			if entry.IsDir() {
+				if key == filesystemMetadataDir || key == filesystemTemporaryDir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.HasPrefix(key, prefix) {
+				return nil
+			}
+			object, err := f.stat(key, filePath, filepath.Join(f.root, filesystemMetadataDir, relativePath+filesystemMetadataSuffix))
+			if errors.Is(err, ErrNotFound) {
+				// removed while walking
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if !yield(object, nil) {
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if walkError != nil {
+			yield(Object{}, walkError)
+		}
+	}
+}
+
+func (f *Filesystem) Health(_ context.Context) error {
+	probe, err := os.CreateTemp(filepath.Join(f.root, filesystemTemporaryDir), "health-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// multipartDirectory - temporary directory holding the parts and options of a multipart upload
+func (f *Filesystem) multipartDirectory(uploadID string) (string, error) {
+	if uploadID == "" || strings.ContainsAny(uploadID, `/\.`) {
+		return "", fmt.Errorf("%w: multipart upload %s", ErrNotFound, uploadID)
+	}
+	return filepath.Join(f.root, filesystemTemporaryDir, "multipart-"+uploadID), nil
+}
+
+// multipartOptions - read the options a multipart upload was started with
+func (f *Filesystem) multipartOptions(key string, directory string) (PutOptions, error) {
+	var options struct {
+		Key string `json:"key"`
+		PutOptions
+	}
+	content, err := os.ReadFile(filepath.Join(directory, "options"+filesystemMetadataSuffix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return PutOptions{}, fmt.Errorf("%w: multipart upload for %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return PutOptions{}, err
+	}
+	if err := json.Unmarshal(content, &options); err != nil {
+		return PutOptions{}, err
+	}
+	if options.Key != key {
+		return PutOptions{}, fmt.Errorf("%w: multipart upload for %s", ErrNotFound, key)
+	}
+	return options.PutOptions, nil
+}
+
+func (f *Filesystem) NewMultipartUpload(_ context.Context, key string, opts PutOptions) (string, error) {
+	if _, _, err := f.paths(key); err != nil {
+		return "", err
+	}
+	uploadID := newUploadID()
+	directory, err := f.multipartDirectory(uploadID)
+	if err != nil {
+		return "", err
+	}
+	content, err := json.Marshal(struct {
+		Key string `json:"key"`
+		PutOptions
+	}{Key: key, PutOptions: opts})
+	if err != nil {
+		return "", err
+	}
+	if err := os.Mkdir(directory, 0o750); err != nil {
+		return "", err
+	}
+	return uploadID, os.WriteFile(filepath.Join(directory, "options"+filesystemMetadataSuffix), content, 0o640)
+}
+
+func (f *Filesystem) PutPart(_ context.Context, key string, uploadID string, number int, reader io.Reader, size int64) (Part, error) {
+	directory, err := f.multipartDirectory(uploadID)
+	if err != nil {
+		return Part{}, err
+	}
+	if _, err := f.multipartOptions(key, directory); err != nil {
+		return Part{}, err
+	}
+
+	partFile, err := os.Create(filepath.Join(directory, strconv.Itoa(number)))
+	if err != nil {
+		return Part{}, err
+	}
+	etagGenerator := md5.New()
+	written, copyError := io.Copy(io.MultiWriter(partFile, etagGenerator), reader)
+	closeError := partFile.Close()
+	if copyError != nil {
+		return Part{}, copyError
+	}
+	if closeError != nil {
+		return Part{}, closeError
+	}
+	if size >= 0 && written != size {
+		return Part{}, fmt.Errorf("expected %d bytes but received %d: %w", size, written, io.ErrUnexpectedEOF)
+	}
+	return Part{Number: number, ETag: hex.EncodeToString(etagGenerator.Sum(nil)), Size: written}, nil
+}
+
+func (f *Filesystem) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) (Object, error) {
+	directory, err := f.multipartDirectory(uploadID)
+	if err != nil {
+		return Object{}, err
+	}
+	opts, err := f.multipartOptions(key, directory)
+	if err != nil {
+		return Object{}, err
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		partFile, err := os.Open(filepath.Join(directory, strconv.Itoa(part.Number)))
+		if err != nil {
+			return Object{}, err
+		}
+		defer partFile.Close()
+		readers = append(readers, partFile)
+	}
+
+	object, err := f.Put(ctx, key, io.MultiReader(readers...), -1, opts)
+	if err != nil {
+		return Object{}, err
+	}
+	return object, os.RemoveAll(directory)
+}
+
+func (f *Filesystem) AbortMultipartUpload(_ context.Context, key string, uploadID string) error {
+	directory, err := f.multipartDirectory(uploadID)
+	if err != nil {
+		return err
+	}
+	if _, err := f.multipartOptions(key, directory); err != nil {
+		return err
+	}
+	return os.RemoveAll(directory)
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFilesystem(t *testing.T) {
+	ctx := context.Background()
+	backend, err := NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Health(ctx); err != nil {
+		t.Fatalf("fresh backend is unhealthy: %v", err)
+	}
+
+	object, err := backend.Put(ctx, "id/test.txt", strings.NewReader("content"), 7, PutOptions{ContentType: "text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.Size != 7 || object.ContentType != "text/plain" || object.ETag == "" {
+		t.Errorf("unexpected object %+v", object)
+	}
+
+	if err := backend.SetMetadata(ctx, "id/test.txt", map[string]string{"Sha512sum": "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	object, err = backend.Stat(ctx, "id/test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.UserMetadata["Sha512sum"] != "abc" || object.ContentType != "text/plain" {
+		t.Errorf("metadata not persisted: %+v", object)
+	}
+
+	reader, err := backend.Get(ctx, "id/test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(content) != "content" {
+		t.Errorf("%+q is expected but %+q is resulting", "content", content)
+	}
+
+	var keys []string
+	for object, err := range backend.List(ctx, "") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, object.Key)
+	}
+	if len(keys) != 1 || keys[0] != "id/test.txt" {
+		t.Errorf("sidecar or temporary files are listed: %v", keys)
+	}
+
+	if err := backend.Delete(ctx, "id/test.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Stat(ctx, "id/test.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := backend.Delete(ctx, "id/test.txt"); err != nil {
+		t.Errorf("deleting a missing object must not fail: %v", err)
+	}
+}
+
+func TestFilesystemRejectsKeysOutsideRoot(t *testing.T) {
+	backend, err := NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"../escape", "/absolute", ".meta/id/file", ".tmp/file"} {
+		if _, err := backend.Put(context.Background(), key, strings.NewReader(""), 0, PutOptions{}); err == nil {
+			t.Errorf("key %+q must be rejected", key)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCapacityExceeded - returned by the memory backend if an object does not fit into its size limit at all
+var ErrCapacityExceeded = errors.New("object exceeds storage capacity")
+
+type memoryObject struct {
+	object  Object
+	content []byte
+	// element - position in the recently used list
+	element *list.Element
+}
+
+// Memory - Backend implementation keeping objects in memory. If the size limit is reached, least recently used
+// objects are evicted.
+type Memory struct {
+	mutex     sync.Mutex
+	maxBytes  int64
+	usedBytes int64
+	objects   map[string]*memoryObject
+	// recentlyUsed - keys ordered from most to least recently used
+	recentlyUsed *list.List
+	multiparts   map[string]*memoryMultipart
+}
+
+// memoryMultipart - state of a multipart upload until it gets completed
+type memoryMultipart struct {
+	key   string
+	opts  PutOptions
+	parts map[int][]byte
+}
+
+// NewMemory - create a Backend holding at most maxBytes of object content; values <= 0 disable the limit
+func NewMemory(maxBytes int64) *Memory {
+	return &Memory{
+		maxBytes:     maxBytes,
+		objects:      make(map[string]*memoryObject),
+		recentlyUsed: list.New(),
+		multiparts:   make(map[string]*memoryMultipart),
+	}
+}
+
+// copyObject - detach the returned object from the internal state
+func copyObject(object Object) Object {
+	object.UserMetadata = maps.Clone(object.UserMetadata)
+	return object
+}
+
+// remove - drop key from the backend; caller must hold the mutex
+func (m *Memory) remove(key string) {
+	stored, ok := m.objects[key]
+	if !ok {
+		return
+	}
+	m.recentlyUsed.Remove(stored.element)
+	m.usedBytes -= int64(len(stored.content))
+	delete(m.objects, key)
+}
+
+func (m *Memory) Put(_ context.Context, key string, reader io.Reader, size int64, opts PutOptions) (Object, error) {
+	if m.maxBytes > 0 && size > m.maxBytes {
+		return Object{}, fmt.Errorf("%w: %d bytes", ErrCapacityExceeded, size)
+	}
+	if m.maxBytes > 0 {
+		reader = io.LimitReader(reader, m.maxBytes+1)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return Object{}, err
+	}
+	if m.maxBytes > 0 && int64(len(content)) > m.maxBytes {
+		return Object{}, fmt.Errorf("%w: more than %d bytes", ErrCapacityExceeded, m.maxBytes)
+	}
+	if size >= 0 && int64(len(content)) != size {
+		return Object{}, fmt.Errorf("expected %d bytes but received %d: %w", size, len(content), io.ErrUnexpectedEOF)
+	}
+
+	etag := md5.Sum(content)
+	object := Object{
+		Key:          key,
+		Size:         int64(len(content)),
+		ContentType:  opts.ContentType,
+		ETag:         hex.EncodeToString(etag[:]),
+		LastModified: time.Now(),
+		UserMetadata: maps.Clone(opts.UserMetadata),
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.remove(key)
+	// evict least recently used objects until the new one fits
+	for m.maxBytes > 0 && m.usedBytes+object.Size > m.maxBytes {
+		m.remove(m.recentlyUsed.Back().Value.(string))
+	}
+	m.objects[key] = &memoryObject{
+		object:  object,
+		content: content,
+		element: m.recentlyUsed.PushFront(key),
+	}
+	m.usedBytes += object.Size
+	return copyObject(object), nil
+}
+
+func (m *Memory) Stat(_ context.Context, key string) (Object, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	stored, ok := m.objects[key]
+	if !ok {
+		return Object{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return copyObject(stored.object), nil
+}
+
+// nopSeekCloser - io.ReadSeekCloser for in memory content
+type nopSeekCloser struct {
+	*bytes.Reader
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+func (m *Memory) Get(_ context.Context, key string) (io.ReadSeekCloser, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	stored, ok := m.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	m.recentlyUsed.MoveToFront(stored.element)
+	// content is never modified after Put, so readers can share it
+	return nopSeekCloser{bytes.NewReader(stored.content)}, nil
+}
+
+func (m *Memory) SetMetadata(_ context.Context, key string, metadata map[string]string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	stored, ok := m.objects[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	stored.object.UserMetadata = maps.Clone(metadata)
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.remove(key)
+	return nil
+}
+
+func (m *Memory) List(_ context.Context, prefix string) iter.Seq2[Object, error] {
+	return func(yield func(Object, error) bool) {
+		// collect a snapshot to not hold the lock while the caller processes objects
+		m.mutex.Lock()
+		var objects []Object
+		for key, stored := range m.objects {
+			if strings.HasPrefix(key, prefix) {
+				objects = append(objects, copyObject(stored.object))
+			}
+		}
+		m.mutex.Unlock()
+
+		slices.SortFunc(objects, func(a, b Object) int {
+			return strings.Compare(a.Key, b.Key)
+		})
+		for _, object := range objects {
+			if !yield(object, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (m *Memory) Health(_ context.Context) error {
+	return nil
+}
+
+func (m *Memory) NewMultipartUpload(_ context.Context, key string, opts PutOptions) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	uploadID := newUploadID()
+	m.multiparts[uploadID] = &memoryMultipart{key: key, opts: opts, parts: make(map[int][]byte)}
+	return uploadID, nil
+}
+
+// multipart - lookup the upload; caller must hold the mutex
+func (m *Memory) multipart(key string, uploadID string) (*memoryMultipart, error) {
+	upload, ok := m.multiparts[uploadID]
+	if !ok || upload.key != key {
+		return nil, fmt.Errorf("%w: multipart upload %s", ErrNotFound, uploadID)
+	}
+	return upload, nil
+}
+
+func (m *Memory) PutPart(_ context.Context, key string, uploadID string, number int, reader io.Reader, size int64) (Part, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return Part{}, err
+	}
+	if size >= 0 && int64(len(content)) != size {
+		return Part{}, fmt.Errorf("expected %d bytes but received %d: %w", size, len(content), io.ErrUnexpectedEOF)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	upload, err := m.multipart(key, uploadID)
+	if err != nil {
+		return Part{}, err
+	}
+	upload.parts[number] = content
+	etag := md5.Sum(content)
+	return Part{Number: number, ETag: hex.EncodeToString(etag[:]), Size: int64(len(content))}, nil
+}
+
+func (m *Memory) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) (Object, error) {
+	m.mutex.Lock()
+	upload, err := m.multipart(key, uploadID)
+	if err != nil {
+		m.mutex.Unlock()
+		return Object{}, err
+	}
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		content, ok := upload.parts[part.Number]
+		if !ok {
+			m.mutex.Unlock()
+			return Object{}, fmt.Errorf("%w: part %d of multipart upload %s", ErrNotFound, part.Number, uploadID)
+		}
+		readers = append(readers, bytes.NewReader(content))
+	}
+	delete(m.multiparts, uploadID)
+	m.mutex.Unlock()
+
+	return m.Put(ctx, key, io.MultiReader(readers...), -1, upload.opts)
+}
+
+func (m *Memory) AbortMultipartUpload(_ context.Context, key string, uploadID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, err := m.multipart(key, uploadID); err != nil {
+		return err
+	}
+	delete(m.multiparts, uploadID)
+	return nil
+}
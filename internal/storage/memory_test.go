@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemory(10)
+
+	for _, key := range []string{"a/1", "b/2"} {
+		if _, err := backend.Put(ctx, key, strings.NewReader("12345"), 5, PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// mark a/1 as recently used, so b/2 gets evicted next
+	if _, err := backend.Get(ctx, "a/1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Put(ctx, "c/3", strings.NewReader("123"), -1, PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := backend.Stat(ctx, "b/2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("b/2 is expected to be evicted, got %v", err)
+	}
+	for _, key := range []string{"a/1", "c/3"} {
+		if _, err := backend.Stat(ctx, key); err != nil {
+			t.Errorf("%+q is expected to be kept: %v", key, err)
+		}
+	}
+}
+
+func TestMemoryRejectsObjectsLargerThanLimit(t *testing.T) {
+	backend := NewMemory(4)
+	for _, size := range []int64{5, -1} {
+		_, err := backend.Put(context.Background(), "a/1", strings.NewReader("12345"), size, PutOptions{})
+		if !errors.Is(err, ErrCapacityExceeded) {
+			t.Errorf("size %d: expected ErrCapacityExceeded, got %v", size, err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+)
+
+// Part - description of an uploaded part of a multipart upload
+type Part struct {
+	Number int
+	ETag   string
+	Size   int64
+}
+
+// MultipartBackend - Backend able to assemble objects from separately uploaded parts. Except for the last one,
+// parts must be at least MinPartSize bytes large.
+type MultipartBackend interface {
+	Backend
+	// NewMultipartUpload starts a multipart upload for key and returns its id
+	NewMultipartUpload(ctx context.Context, key string, opts PutOptions) (string, error)
+	// PutPart stores the part with the given number; numbers start at 1
+	PutPart(ctx context.Context, key string, uploadID string, number int, reader io.Reader, size int64) (Part, error)
+	// CompleteMultipartUpload concatenates parts in the given order to the final object
+	CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) (Object, error)
+	// AbortMultipartUpload discards the upload including all stored parts
+	AbortMultipartUpload(ctx context.Context, key string, uploadID string) error
+}
+
+// MinPartSize - smallest part size accepted by s3 for all but the last part
+const MinPartSize = 5 << 20
+
+// newUploadID - random id for multipart uploads of backends without native support
+func newUploadID() string {
+	return rand.Text()
+}
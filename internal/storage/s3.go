@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// unknownSizePartSize - part size used for streams without known length; minio would otherwise buffer 512MiB parts
+const unknownSizePartSize = 16 << 20
+
+// S3 - Backend implementation for s3 compatible object storage
+type S3 struct {
+	client *minio.Client
+	// core - low level api used for multipart uploads
+	core   minio.Core
+	bucket string
+}
+
+// NewS3 - create a Backend storing objects in bucket of the s3 service reachable at endpoint
+func NewS3(endpoint string, bucket string, options *minio.Options) (*S3, error) {
+	client, err := minio.New(endpoint, options)
+	if err != nil {
+		return nil, err
+	}
+	return &S3{client: client, core: minio.Core{Client: client}, bucket: bucket}, nil
+}
+
+// translateError - map s3 error responses to the package errors
+func (s *S3) translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
+
+func objectFromInfo(info minio.ObjectInfo) Object {
+	return Object{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+		UserMetadata: info.UserMetadata,
+	}
+}
+
+func (s *S3) Put(ctx context.Context, key string, reader io.Reader, size int64, opts PutOptions) (Object, error) {
+	putOptions := minio.PutObjectOptions{
+		ContentType:  opts.ContentType,
+		UserMetadata: opts.UserMetadata,
+	}
+	if size < 0 {
+		putOptions.PartSize = unknownSizePartSize
+	}
+	info, err := s.client.PutObject(ctx, s.bucket, key, reader, size, putOptions)
+	if err != nil {
+		return Object{}, s.translateError(err)
+	}
+	return Object{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  opts.ContentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+		UserMetadata: opts.UserMetadata,
+	}, nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (Object, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return Object{}, s.translateError(err)
+	}
+	return objectFromInfo(info), nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.translateError(err)
+	}
+	return object, nil
+}
+
+func (s *S3) SetMetadata(ctx context.Context, key string, metadata map[string]string) error {
+	// copying with replaced metadata resets the content type unless it is sent again
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return s.translateError(err)
+	}
+	_, err = s.client.CopyObject(ctx, minio.CopyDestOptions{
+		Bucket:          s.bucket,
+		Object:          key,
+		UserMetadata:    metadata,
+		ReplaceMetadata: true,
+		ContentType:     info.ContentType,
+	}, minio.CopySrcOptions{
+		Bucket:    s.bucket,
+		Object:    key,
+		MatchETag: info.ETag,
+	})
+	return s.translateError(err)
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	return s.translateError(s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}))
+}
+
+func (s *S3) List(ctx context.Context, prefix string) iter.Seq2[Object, error] {
+	return func(yield func(Object, error) bool) {
+		// stop the listing goroutine of minio if the caller leaves the loop early
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			if info.Err != nil {
+				yield(Object{}, s.translateError(info.Err))
+				return
+			}
+			if !yield(objectFromInfo(info), nil) {
+				return
+			}
+		}
+	}
+}
+
+func (s *S3) Health(ctx context.Context) error {
+	exist, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return fmt.Errorf("bucket %+q does not exist", s.bucket)
+	}
+	return nil
+}
+
+func (s *S3) NewMultipartUpload(ctx context.Context, key string, opts PutOptions) (string, error) {
+	uploadID, err := s.core.NewMultipartUpload(ctx, s.bucket, key, minio.PutObjectOptions{
+		ContentType:  opts.ContentType,
+		UserMetadata: opts.UserMetadata,
+	})
+	return uploadID, s.translateError(err)
+}
+
+func (s *S3) PutPart(ctx context.Context, key string, uploadID string, number int, reader io.Reader, size int64) (Part, error) {
+	part, err := s.core.PutObjectPart(ctx, s.bucket, key, uploadID, number, reader, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return Part{}, s.translateError(err)
+	}
+	return Part{Number: part.PartNumber, ETag: part.ETag, Size: part.Size}, nil
+}
+
+func (s *S3) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) (Object, error) {
+	completeParts := make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		completeParts = append(completeParts, minio.CompletePart{PartNumber: part.Number, ETag: part.ETag})
+	}
+	if _, err := s.core.CompleteMultipartUpload(ctx, s.bucket, key, uploadID, completeParts, minio.PutObjectOptions{}); err != nil {
+		return Object{}, s.translateError(err)
+	}
+	return s.Stat(ctx, key)
+}
+
+func (s *S3) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	return s.translateError(s.core.AbortMultipartUpload(ctx, s.bucket, key, uploadID))
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// fakeS3Object - object of fakeS3 with the attributes relevant for metadata updates
+type fakeS3Object struct {
+	contentType string
+	metadata    http.Header
+}
+
+// fakeS3 - s3 api answering stat and copy requests for a single object like s3 does
+type fakeS3 struct {
+	object fakeS3Object
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodHead:
+		for name, values := range f.object.metadata {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Content-Type", f.object.contentType)
+		w.Header().Set("Content-Length", "7")
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+			// s3 replaces the content type along with the metadata and falls back to binary data
+			f.object.contentType = r.Header.Get("Content-Type")
+			if f.object.contentType == "" {
+				f.object.contentType = "binary/octet-stream"
+			}
+			f.object.metadata = make(http.Header)
+			for name, values := range r.Header {
+				if strings.HasPrefix(name, "X-Amz-Meta-") {
+					f.object.metadata[name] = values
+				}
+			}
+		}
+		w.Write([]byte(`<CopyObjectResult><ETag>"etag"</ETag><LastModified>2024-01-01T00:00:00.000Z</LastModified></CopyObjectResult>`))
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestS3SetMetadataKeepsContentType(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{object: fakeS3Object{contentType: "text/plain; charset=utf-8"}})
+	t.Cleanup(server.Close)
+
+	backend, err := NewS3(strings.TrimPrefix(server.URL, "http://"), "bucket", &minio.Options{
+		Creds:        credentials.NewStaticV4("access", "secret", ""),
+		Region:       "us-east-1",
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := backend.SetMetadata(ctx, "id/file.txt", map[string]string{"Downloads": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	object, err := backend.Stat(ctx, "id/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.ContentType != "text/plain; charset=utf-8" || object.UserMetadata["Downloads"] != "1" {
+		t.Errorf("unexpected content type %+q and metadata %v after the update", object.ContentType, object.UserMetadata)
+	}
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"time"
+)
+
+// ErrNotFound - returned by backends if the requested object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// Object - backend independent description of a stored object
+type Object struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+	UserMetadata map[string]string
+}
+
+// PutOptions - optional attributes stored together with a new object
+type PutOptions struct {
+	ContentType  string
+	UserMetadata map[string]string
+}
+
+// Backend - storage for uploaded objects. Keys follow the <id>/<filename> layout.
+type Backend interface {
+	// Put stores the content of reader under key. A size of -1 denotes an unknown length.
+	Put(ctx context.Context, key string, reader io.Reader, size int64, opts PutOptions) (Object, error)
+	// Stat returns the object description without its content
+	Stat(ctx context.Context, key string) (Object, error)
+	// Get opens the object content for reading
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// SetMetadata replaces the user metadata of an existing object and keeps its content type
+	SetMetadata(ctx context.Context, key string, metadata map[string]string) error
+	// Delete removes the object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// List iterates over all objects with the given key prefix
+	List(ctx context.Context, prefix string) iter.Seq2[Object, error]
+	// Health reports whether the backend is able to serve requests
+	Health(ctx context.Context) error
+}
@@ -21,12 +21,45 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"transfer/internal/auth"
 	"transfer/internal/metrics"
+	"transfer/internal/storage"
 )
 
 // ChecksumMetadataFieldName - UserMetadata key for storing the checksum of the file
 const ChecksumMetadataFieldName = "Sha512sum"
 
+// ExpiryMetadataFieldName - UserMetadata key for storing the time after which the file gets deleted
+const ExpiryMetadataFieldName = "Expiry"
+
+// MaxDownloadsMetadataFieldName - UserMetadata key for storing the allowed number of downloads
+const MaxDownloadsMetadataFieldName = "Max-Downloads"
+
+// DownloadsMetadataFieldName - UserMetadata key for counting the downloads of files with download limit
+const DownloadsMetadataFieldName = "Downloads"
+
+// DeletionTokenMetadataFieldName - UserMetadata key for storing the hashed deletion token of the file
+const DeletionTokenMetadataFieldName = "Deletion-Token"
+
+// UploaderMetadataFieldName - UserMetadata key for storing the name of the authenticated uploader
+const UploaderMetadataFieldName = "Uploader"
+
+// PasswordMetadataFieldName - UserMetadata key for storing the bcrypt hash of the download password
+const PasswordMetadataFieldName = "Password-Hash"
+
+// EncryptionKeyCheckMetadataFieldName - UserMetadata key for storing the check value of the encryption key
+const EncryptionKeyCheckMetadataFieldName = "Encryption-Key-Check"
+
+// ClientEncryptionMetadataFieldName - UserMetadata key marking files encrypted by the client, e.g. with age
+const ClientEncryptionMetadataFieldName = "Client-Encryption"
+
+// OriginalFilenameMetadataFieldName - UserMetadata key for storing the url encoded filename given by the uploader
+const OriginalFilenameMetadataFieldName = "Original-Filename"
+
+// UploadedMetadataFieldName - UserMetadata key for storing the time of the upload; s3 resets the last modification
+// time whenever the metadata changes
+const UploadedMetadataFieldName = "Uploaded"
+
 type State string
 
 const (
@@ -40,28 +73,71 @@ var (
 )
 
 type Config struct {
-	logger      *log.Logger
-	minioClient *minio.Client
+	logger     *log.Logger
+	storage    storage.Backend
+	tusUploads tusRegistry
+	// credentials - allowed uploaders; uploads are anonymous if nil
+	credentials auth.Credentials
+	quota       quotaTracker
+	// signer - signs and verifies download links; links are unsigned if nil
+	signer *linkSigner
+	// cleanupMutex - serializes cleanup runs of the worker and the admin api
+	cleanupMutex sync.Mutex
+	// downloadLocks - serializes updates of the download counters per object
+	downloadLocks keyedMutex
+	// uploadLocks - serializes uploads adding the same file to an existing upload
+	uploadLocks keyedMutex
 }
 
 type Parameters struct {
-	HealthCheckInterval  int
-	HealthCheckReturnGap time.Duration
-	CleanupInterval      int
-	ListenAddress        string
-	MetricsListenAddress string
-	DownloadLinkPrefix   string
-	S3Endpoint           string
-	S3AccessKey          string
-	S3SecretKey          string
-	S3BucketName         string
-	S3UseSecurity        bool
-	UploadLimitGB        int64
-	DisableCleanupWorker bool
+	HealthCheckInterval   int
+	HealthCheckReturnGap  time.Duration
+	CleanupInterval       int
+	ListenAddress         string
+	MetricsListenAddress  string
+	DownloadLinkPrefix    string
+	StorageBackend        string
+	S3Endpoint            string
+	S3AccessKey           string
+	S3SecretKey           string
+	S3BucketName          string
+	S3UseSecurity         bool
+	FilesystemPath        string
+	MemoryLimitMB         int64
+	UploadLimitGB         int64
+	DisableCleanupWorker  bool
+	TusExpiration         time.Duration
+	RetentionDefault      time.Duration
+	RetentionMin          time.Duration
+	RetentionMax          time.Duration
+	RetentionMaxDownloads int
+	AuthCredentialsFile   string
+	EncryptionEnable      bool
+	RequireAge            bool
+	AdminToken            string
+	InlineTypes           []string
+	ContentDomain         string
+	ContentTypeSource     string
+	LinkSigningKeys       []string
+	LinkSigningKeyFile    string
+	LinkTTL               time.Duration
 }
 
 var p Parameters
 
+// command - subcommand selected on the command line
+var command string
+
+// serveCommand - default subcommand running the server
+const serveCommand = "serve"
+
+// available values for --storage.backend
+const (
+	storageBackendS3         = "s3"
+	storageBackendFilesystem = "filesystem"
+	storageBackendMemory     = "memory"
+)
+
 func init() {
 	// skip init if running in go test environment
 	if strings.Contains(os.Args[0], "/_test/") || strings.HasSuffix(os.Args[0], ".test") {
@@ -69,25 +145,47 @@ func init() {
 	}
 
 	app := kingpin.New("transfer", "Daemon transferring files to s3 compatible storage")
+	app.Command(serveCommand, "run the transfer server").Default()
+	registerClientCommands(app)
+	registerAdminCommands(app)
 	app.Flag("web.listen-address", "web server listen address").Default(":8080").StringVar(&p.ListenAddress)
 	app.Flag("metrics.listen-address", "metrics endpoint listen address").Default("127.0.0.1:9042").StringVar(&p.MetricsListenAddress)
 	app.Flag("upload.limit", "Upload limit in GiB").Envar("UPLOAD_LIMIT").Default("2").Int64Var(&p.UploadLimitGB)
 	app.Flag("cleanup.interval", "interval in seconds for cleanup").Default("60").IntVar(&p.CleanupInterval)
 	app.Flag("healthcheck.interval", "interval in seconds for healthcheck").Default("2").IntVar(&p.HealthCheckInterval)
 	app.Flag("healthcheck.return.gap", "time in seconds for declaring the service as healthy after successful check").Default("2s").DurationVar(&p.HealthCheckReturnGap)
+	app.Flag("storage.backend", "storage backend for uploaded files").Envar("STORAGE_BACKEND").Default(storageBackendS3).EnumVar(&p.StorageBackend, storageBackendS3, storageBackendFilesystem, storageBackendMemory)
 	app.Flag("s3.endpoint", "address to s3 endpoint").Envar("S3_ENDPOINT").StringVar(&p.S3Endpoint)
 	app.Flag("s3.access", "s3 access key").Envar("AWS_ACCESS_KEY_ID").StringVar(&p.S3AccessKey)
 	app.Flag("s3.secret", "s3 secret key").Envar("AWS_SECRET_ACCESS_KEY").StringVar(&p.S3SecretKey)
 	app.Flag("s3.bucket", "s3 storage bucket").Envar("S3_BUCKET").StringVar(&p.S3BucketName)
 	app.Flag("s3.secure", "use tls for connection").Envar("S3_SECURE").Default("true").BoolVar(&p.S3UseSecurity)
+	app.Flag("filesystem.path", "directory for the filesystem storage backend").Envar("FILESYSTEM_PATH").Default("data").StringVar(&p.FilesystemPath)
+	app.Flag("memory.limit", "size limit in MiB for the memory storage backend; least recently used files are evicted").Envar("MEMORY_LIMIT").Default("512").Int64Var(&p.MemoryLimitMB)
+	app.Flag("tus.expiration", "time after which incomplete resumable uploads without activity are discarded").Default("24h").DurationVar(&p.TusExpiration)
+	app.Flag("retention.default", "time files are kept if the uploader does not send Max-Days").Envar("RETENTION_DEFAULT").Default("1h").DurationVar(&p.RetentionDefault)
+	app.Flag("retention.min", "lower bound for Max-Days requested by uploaders").Envar("RETENTION_MIN").Default("1m").DurationVar(&p.RetentionMin)
+	app.Flag("retention.max", "upper bound for Max-Days requested by uploaders").Envar("RETENTION_MAX").Default("168h").DurationVar(&p.RetentionMax)
+	app.Flag("retention.max-downloads", "upper bound for Max-Downloads requested by uploaders; 0 allows unlimited downloads").Envar("RETENTION_MAX_DOWNLOADS").Default("0").IntVar(&p.RetentionMaxDownloads)
+	app.Flag("encryption.enable", "encrypt every upload with a random key only contained in its download link").Envar("ENCRYPTION_ENABLE").BoolVar(&p.EncryptionEnable)
+	app.Flag("encryption.require-age", "reject uploads which are not encrypted with age by the client").Envar("ENCRYPTION_REQUIRE_AGE").BoolVar(&p.RequireAge)
+	app.Flag("admin.token", "bearer token for the admin api on the metrics listener; the api is disabled if not set").Envar("ADMIN_TOKEN").StringVar(&p.AdminToken)
+	app.Flag("content.inline-types", "media types browsers may display inline; all other files are served as application/octet-stream").Envar("CONTENT_INLINE_TYPES").Default(defaultInlineTypes...).StringsVar(&p.InlineTypes)
+	app.Flag("content.type-source", "source of the stored content type: auto prefers the sniffed type unless it is less specific than the extension").Envar("CONTENT_TYPE_SOURCE").Default(contentTypeSourceAuto).EnumVar(&p.ContentTypeSource, contentTypeSourceAuto, contentTypeSourceExtension, contentTypeSourceContent)
+	app.Flag("content.domain", "separate host serving the files displayed by preview pages, e.g. usercontent.example.com").Envar("CONTENT_DOMAIN").StringVar(&p.ContentDomain)
+	app.Flag("auth.credentials-file", "json file with credentials and quotas of uploaders; uploads are anonymous if not set").Envar("AUTH_CREDENTIALS_FILE").StringVar(&p.AuthCredentialsFile)
+	app.Flag("link.signing-key", "key for signing download links; repeat for key rotation, the first key signs new links").Envar("LINK_SIGNING_KEY").StringsVar(&p.LinkSigningKeys)
+	app.Flag("link.signing-key-file", "file with one key for signing download links per line, used after --link.signing-key").Envar("LINK_SIGNING_KEY_FILE").StringVar(&p.LinkSigningKeyFile)
+	app.Flag("link.ttl", "lifetime of signed download links; 0 lets links expire together with the file").Default("0").DurationVar(&p.LinkTTL)
 	app.Flag("cleanup.disable", "manage object deletion process").Default("false").BoolVar(&p.DisableCleanupWorker)
 	app.Flag("link.prefix", "prepending stuff for download link").Default("http").StringVar(&p.DownloadLinkPrefix)
 
 	app.HelpFlag.Short('h')
 	app.Version(version.Print(os.Args[0]))
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	command = kingpin.MustParse(app.Parse(os.Args[1:]))
 
-	if p.S3AccessKey == "" || p.S3SecretKey == "" || p.S3Endpoint == "" || p.S3BucketName == "" {
+	usesStorage := command == serveCommand || strings.HasPrefix(command, adminCommand+" ")
+	if usesStorage && p.StorageBackend == storageBackendS3 && (p.S3AccessKey == "" || p.S3SecretKey == "" || p.S3Endpoint == "" || p.S3BucketName == "") {
 		fmt.Println("no s3 details given")
 		os.Exit(1)
 	}
@@ -96,6 +194,60 @@ func init() {
 	runtime.GOMAXPROCS(-1)
 }
 
+// newStorageBackend - create the storage backend selected by --storage.backend
+func newStorageBackend() (storage.Backend, error) {
+	switch p.StorageBackend {
+	case storageBackendS3:
+		return storage.NewS3(p.S3Endpoint, p.S3BucketName, &minio.Options{
+			Creds:     credentials.NewStaticV4(p.S3AccessKey, p.S3SecretKey, ""),
+			Secure:    p.S3UseSecurity,
+			Transport: metrics.RoundTripper{},
+		})
+	case storageBackendFilesystem:
+		return storage.NewFilesystem(p.FilesystemPath)
+	case storageBackendMemory:
+		return storage.NewMemory(p.MemoryLimitMB * metrics.MB), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %+q", p.StorageBackend)
+	}
+}
+
+// applicationRouter - routes of the public web server
+func (c *Config) applicationRouter() *mux.Router {
+	sentryHandler := sentryhttp.New(sentryhttp.Options{
+		WaitForDelivery: false,
+		// http.ErrAbortHandler has to reach the http server to abort incomplete downloads
+		Repanic: true,
+	})
+
+	router := mux.NewRouter()
+	router.Use(sentryHandler.Handle)
+	// resumable uploads are registered first, as HEAD /files/{id} would otherwise be handled as download
+	router.HandleFunc("/files/", metrics.ApiMiddleware(tusMiddleware(c.TusOptionsHandler), c.logger, "tus.options")).Methods(http.MethodOptions)
+	router.HandleFunc("/files/", metrics.ApiMiddleware(tusMiddleware(c.authenticateUpload(c.TusCreateHandler)), c.logger, "tus.create")).Methods(http.MethodPost)
+	router.HandleFunc("/files/{id}", metrics.ApiMiddleware(tusMiddleware(c.TusOptionsHandler), c.logger, "tus.options")).Methods(http.MethodOptions)
+	router.HandleFunc("/files/{id}", metrics.ApiMiddleware(tusMiddleware(c.TusHeadHandler), c.logger, "tus.head")).Methods(http.MethodHead)
+	router.HandleFunc("/files/{id}", metrics.ApiMiddleware(tusMiddleware(c.TusPatchHandler), c.logger, "tus.patch")).Methods(http.MethodPatch)
+	router.HandleFunc("/files/{id}", metrics.ApiMiddleware(tusMiddleware(c.TusDeleteHandler), c.logger, "tus.delete")).Methods(http.MethodDelete)
+	router.HandleFunc("/", metrics.ApiMiddleware(c.authenticateUpload(c.FormUploadHandler), c.logger, "upload.form")).Methods(http.MethodPost)
+	router.HandleFunc("/", metrics.ApiMiddleware(c.IndexHandler, c.logger, "index")).Methods(http.MethodGet, http.MethodHead)
+	router.PathPrefix("/static/").Handler(staticHandler()).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/{filename}", metrics.ApiMiddleware(c.authenticateUpload(c.UploadHandler), c.logger, "upload")).Methods(http.MethodPut)
+	router.HandleFunc("/{id}/{filename}", metrics.ApiMiddleware(c.authenticateUpload(c.UploadHandler), c.logger, "upload")).Methods(http.MethodPut)
+	router.HandleFunc("/{id}/", metrics.ApiMiddleware(c.ListHandler, c.logger, "list")).Methods(http.MethodGet)
+	router.HandleFunc(`/{id}.{format:zip|tar\.gz}`, metrics.ApiMiddleware(c.BundleHandler, c.logger, "bundle")).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/{id}/{filename}", metrics.ApiMiddleware(c.DownloadHandler, c.logger, "download")).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/{id}/{filename}", metrics.ApiMiddleware(c.DeleteHandler, c.logger, "delete")).Methods(http.MethodDelete)
+	// links of encrypted uploads carry the key in front of the filename; they are registered first, as the link of an
+	// encrypted file named sum or info would otherwise be handled as checksum or info request
+	router.HandleFunc("/{id}/{key:[A-Za-z0-9_-]{43}}/{filename}", metrics.ApiMiddleware(c.DownloadHandler, c.logger, "download")).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/{id}/{key:[A-Za-z0-9_-]{43}}/{filename}/{sum:sum}", metrics.ApiMiddleware(c.DownloadHandler, c.logger, "sum")).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/{id}/{key:[A-Za-z0-9_-]{43}}/{filename}/{info:info}", metrics.ApiMiddleware(c.DownloadHandler, c.logger, "info")).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/{id}/{filename}/{sum:sum}", metrics.ApiMiddleware(c.DownloadHandler, c.logger, "sum")).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/{id}/{filename}/{info:info}", metrics.ApiMiddleware(c.DownloadHandler, c.logger, "info")).Methods(http.MethodGet, http.MethodHead)
+	return router
+}
+
 func webListener(server *http.Server, group *sync.WaitGroup) {
 	log.Printf("Listening on %+q\n", server.Addr)
 	if err := server.ListenAndServe(); err != nil {
@@ -105,20 +257,52 @@ func webListener(server *http.Server, group *sync.WaitGroup) {
 }
 
 func main() {
+	if strings.HasPrefix(command, adminCommand+" ") {
+		if err := runAdmin(context.Background(), command); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if command != serveCommand {
+		if err := runClientCommand(context.Background(), command); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	serve()
+}
+
+// serve - run the web servers and workers until an interrupt is received
+func serve() {
 	serverWaiter := sync.WaitGroup{}
 	var c = Config{}
 	var err error
 
 	c.logger = log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lshortfile|log.Lmsgprefix)
-	c.minioClient, err = minio.New(p.S3Endpoint, &minio.Options{
-		Creds:     credentials.NewStaticV4(p.S3AccessKey, p.S3SecretKey, ""),
-		Secure:    p.S3UseSecurity,
-		Transport: metrics.RoundTripper{},
-	})
+	c.storage, err = newStorageBackend()
 	if err != nil {
 		c.logger.Println(err)
 		os.Exit(1)
 	}
+	signingKeys, err := loadSigningKeys(p.LinkSigningKeys, p.LinkSigningKeyFile)
+	if err != nil {
+		c.logger.Println(err)
+		os.Exit(1)
+	}
+	if len(signingKeys) > 0 {
+		c.signer = &linkSigner{keys: signingKeys, ttl: p.LinkTTL}
+	}
+	if p.AuthCredentialsFile != "" {
+		if c.credentials, err = auth.Load(p.AuthCredentialsFile); err != nil {
+			c.logger.Println(err)
+			os.Exit(1)
+		}
+		if err := c.refreshQuotaUsage(context.Background()); err != nil {
+			c.logger.Println(err)
+		}
+	}
 
 	sentryInitError := sentry.Init(sentry.ClientOptions{
 		Release:          version.Revision,
@@ -126,22 +310,19 @@ func main() {
 		Debug:            false,
 		EnableTracing:    true,
 		AttachStacktrace: true,
+		// download links carry encryption keys and tokens
+		BeforeSend:            metrics.RedactSentryEvent,
+		BeforeSendTransaction: metrics.RedactSentryEvent,
 	})
 	log.Println(sentryInitError)
-	sentryHandler := sentryhttp.New(sentryhttp.Options{
-		WaitForDelivery: false,
-	})
 
-	applicationRouter := mux.NewRouter()
-	applicationRouter.Use(sentryHandler.Handle)
-	applicationRouter.HandleFunc("/{filename}", metrics.ApiMiddleware(c.UploadHandler, c.logger, "upload")).Methods(http.MethodPut)
-	applicationRouter.HandleFunc("/{id}/{filename}", metrics.ApiMiddleware(c.DownloadHandler, c.logger, "download")).Methods(http.MethodGet, http.MethodHead)
-	applicationRouter.HandleFunc("/{id}/{filename}/{sum:sum}", metrics.ApiMiddleware(c.DownloadHandler, c.logger, "sum")).Methods(http.MethodGet, http.MethodHead)
+	applicationRouter := c.applicationRouter()
 
 	metricsRouter := mux.NewRouter()
 	metricsRouter.Handle("/metrics", promhttp.Handler()).Methods(http.MethodGet)
 	metricsRouter.HandleFunc("/-/ready", c.HealthCheckHandler).Methods(http.MethodGet)
 	metricsRouter.HandleFunc("/-/healthy", c.HealthCheckHandler).Methods(http.MethodGet)
+	c.registerAdminAPI(metricsRouter)
 
 	// declare http applicationServer
 	servers := []*http.Server{
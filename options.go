@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"transfer/internal/auth"
+	"transfer/internal/encryption"
+)
+
+// uploadOptions - client controlled properties of an upload
+type uploadOptions struct {
+	expiry       time.Time
+	maxDownloads int
+	// deletionToken - secret allowing the uploader to delete the files; only its hash is stored
+	deletionToken string
+	// uploader - name of the authenticated credential, empty for anonymous uploads
+	uploader string
+	// passwordHash - hash of the password required for downloads, empty for public uploads
+	passwordHash string
+	// encryptionKey - key the content is encrypted with, nil if encryption is disabled
+	encryptionKey *encryption.Key
+	// originalFilename - filename given by the client; the object key only contains its ascii slug
+	originalFilename string
+	// digests - checksums of the content announced by the client, verified after the upload
+	digests expectedDigests
+	// clientEncryption - encryption applied by the client as detected from the content, empty for plaintext
+	clientEncryption string
+}
+
+// parseUploadOptions - read the upload properties from the request headers and bound them by the server limits
+func parseUploadOptions(r *http.Request) (uploadOptions, error) {
+	var options uploadOptions
+
+	retention := p.RetentionDefault
+	if value := r.Header.Get("Max-Days"); value != "" {
+		var err error
+		if retention, err = parseRetention(value); err != nil {
+			return options, err
+		}
+	}
+	retention = max(p.RetentionMin, min(retention, p.RetentionMax))
+	credential, authenticated := auth.FromContext(r.Context())
+	if authenticated {
+		options.uploader = credential.Name
+		if credential.MaxRetention > 0 {
+			retention = min(retention, time.Duration(credential.MaxRetention))
+		}
+	}
+	options.expiry = time.Now().Add(retention).Truncate(time.Second)
+
+	options.maxDownloads = p.RetentionMaxDownloads
+	if value := r.Header.Get("Max-Downloads"); value != "" {
+		maxDownloads, err := strconv.Atoi(value)
+		if err != nil || maxDownloads <= 0 {
+			return options, fmt.Errorf("invalid Max-Downloads %+q", value)
+		}
+		if p.RetentionMaxDownloads == 0 || maxDownloads < p.RetentionMaxDownloads {
+			options.maxDownloads = maxDownloads
+		}
+	}
+
+	if password := r.Header.Get(downloadPasswordHeader); password != "" {
+		var err error
+		if options.passwordHash, err = hashDownloadPassword(password); err != nil {
+			return options, err
+		}
+	}
+
+	if p.EncryptionEnable {
+		key := encryption.NewKey()
+		options.encryptionKey = &key
+	}
+
+	options.deletionToken = rand.Text()
+	return options, nil
+}
+
+// metadata - object metadata representing the options
+func (o uploadOptions) metadata() map[string]string {
+	metadata := map[string]string{
+		ExpiryMetadataFieldName:        o.expiry.UTC().Format(time.RFC3339),
+		DeletionTokenMetadataFieldName: hashDeletionToken(o.deletionToken),
+		UploadedMetadataFieldName:      time.Now().UTC().Format(time.RFC3339),
+	}
+	if o.originalFilename != "" {
+		metadata[OriginalFilenameMetadataFieldName] = encodeFilenameMetadata(o.originalFilename)
+	}
+	if o.uploader != "" {
+		metadata[UploaderMetadataFieldName] = o.uploader
+	}
+	if o.encryptionKey != nil {
+		metadata[EncryptionKeyCheckMetadataFieldName] = o.encryptionKey.Check()
+	}
+	if o.clientEncryption != "" {
+		metadata[ClientEncryptionMetadataFieldName] = o.clientEncryption
+	}
+	if o.passwordHash != "" {
+		metadata[PasswordMetadataFieldName] = o.passwordHash
+	}
+	if o.maxDownloads > 0 {
+		metadata[MaxDownloadsMetadataFieldName] = strconv.Itoa(o.maxDownloads)
+		metadata[DownloadsMetadataFieldName] = "0"
+	}
+	return metadata
+}
+
+// setResponseHeaders - echo the effective options to the uploader
+func (o uploadOptions) setResponseHeaders(w http.ResponseWriter) {
+	w.Header().Set("X-Expires", o.expiry.UTC().Format(http.TimeFormat))
+	if o.maxDownloads > 0 {
+		w.Header().Set("Max-Downloads", strconv.Itoa(o.maxDownloads))
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"transfer/internal/storage"
+)
+
+// downloadPasswordHeader - request header setting the password required for downloading the uploaded files
+const downloadPasswordHeader = "X-Download-Password"
+
+// hashDownloadPassword - bcrypt hash of a download password stored in the object metadata
+func hashDownloadPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", errors.New("download password must not exceed 72 bytes")
+	}
+	return string(hash), err
+}
+
+// requestPassword - download password given by basic auth or the password query/form field
+func requestPassword(r *http.Request) string {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return r.FormValue("password")
+}
+
+// rejectWithoutPassword - write an error response if object is password protected and the request does not carry
+// its password
+func rejectWithoutPassword(w http.ResponseWriter, r *http.Request, object storage.Object) bool {
+	hash := object.UserMetadata[PasswordMetadataFieldName]
+	if hash == "" {
+		return false
+	}
+	password := requestPassword(r)
+	if password == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="transfer", charset="UTF-8"`)
+		http.Error(w, "password required", http.StatusUnauthorized)
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		http.Error(w, "invalid password", http.StatusForbidden)
+		return true
+	}
+	return false
+}
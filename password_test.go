@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPasswordProtectedDownload(t *testing.T) {
+	server, _ := newTestServer(t)
+	const content = "vendor logs"
+
+	request := mustRequest(t, http.MethodPut, server.URL+"/logs.txt", strings.NewReader(content))
+	request.Header.Set(downloadPasswordHeader, "correct horse")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("upload returned %d: %v", response.StatusCode, err)
+	}
+	link := strings.TrimSpace(string(body))
+
+	withBasicAuth := func(password string) *http.Request {
+		request := mustRequest(t, http.MethodGet, link, nil)
+		request.SetBasicAuth("", password)
+		return request
+	}
+	tests := []struct {
+		Name     string
+		Request  *http.Request
+		Expected int
+	}{
+		{Name: "missing", Request: mustRequest(t, http.MethodGet, link, nil), Expected: http.StatusUnauthorized},
+		{Name: "missing sum", Request: mustRequest(t, http.MethodGet, link+"/sum", nil), Expected: http.StatusUnauthorized},
+		{Name: "wrong", Request: withBasicAuth("wrong"), Expected: http.StatusForbidden},
+		{Name: "basic auth", Request: withBasicAuth("correct horse"), Expected: http.StatusOK},
+		{Name: "query", Request: mustRequest(t, http.MethodGet, link+"?"+url.Values{"password": {"correct horse"}}.Encode(), nil), Expected: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			response, err := http.DefaultClient.Do(test.Request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			if response.StatusCode != test.Expected {
+				t.Errorf("expected status %d, got %d", test.Expected, response.StatusCode)
+			}
+		})
+	}
+}
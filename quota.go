@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"transfer/internal/auth"
+	"transfer/internal/metrics"
+)
+
+// usage - stored files of one uploader
+type usage struct {
+	bytes int64
+	files int
+}
+
+// quotaTracker - usage per uploader, rebuilt from the storage by the cleanup and updated by every upload in between.
+// Quota held by uploads in progress is tracked separately, so that rebuilding the usage does not drop it.
+type quotaTracker struct {
+	mutex sync.Mutex
+	usage map[string]usage
+	// reserved - quota held by uploads whose content is still streamed
+	reserved map[string]usage
+}
+
+// changeUsage - add bytes and files, negative to subtract, to the usage of uploader in usages
+func changeUsage(usages map[string]usage, uploader string, bytes int64, files int) map[string]usage {
+	if usages == nil {
+		usages = make(map[string]usage)
+	}
+	current := usages[uploader]
+	usages[uploader] = usage{bytes: max(current.bytes+bytes, 0), files: max(current.files+files, 0)}
+	return usages
+}
+
+// get - stored and reserved usage of uploader
+func (q *quotaTracker) get(uploader string) usage {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.current(uploader)
+}
+
+func (q *quotaTracker) current(uploader string) usage {
+	stored, reserved := q.usage[uploader], q.reserved[uploader]
+	return usage{bytes: stored.bytes + reserved.bytes, files: stored.files + reserved.files}
+}
+
+// reserve - hold one file and size bytes for an upload of uploader if its usage stays within maxBytes and maxFiles
+// (0 for unlimited). Uploads of unknown size (-1) hold all remaining bytes. Returns the held bytes and a http status
+// code describing whether the upload is allowed.
+func (q *quotaTracker) reserve(uploader string, size int64, maxBytes int64, maxFiles int) (int64, int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	current := q.current(uploader)
+	if maxBytes > 0 {
+		remaining := max(maxBytes-current.bytes, 0)
+		if size > remaining {
+			return 0, http.StatusRequestEntityTooLarge
+		}
+		if size < 0 {
+			size = remaining
+		}
+	}
+	if maxFiles > 0 && current.files >= maxFiles {
+		return 0, http.StatusForbidden
+	}
+	size = max(size, 0)
+	q.reserved = changeUsage(q.reserved, uploader, size, 1)
+	return size, http.StatusOK
+}
+
+// commit - turn a reservation of reserved bytes into a stored file of size bytes
+func (q *quotaTracker) commit(uploader string, reserved int64, size int64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.reserved = changeUsage(q.reserved, uploader, -reserved, -1)
+	q.usage = changeUsage(q.usage, uploader, size, 1)
+}
+
+// release - drop a reservation of reserved bytes
+func (q *quotaTracker) release(uploader string, reserved int64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.reserved = changeUsage(q.reserved, uploader, -reserved, -1)
+}
+
+// remove - forget a deleted file of size bytes
+func (q *quotaTracker) remove(uploader string, size int64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.usage = changeUsage(q.usage, uploader, -size, -1)
+}
+
+func (q *quotaTracker) replace(current map[string]usage) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.usage = current
+}
+
+// authenticateUpload - require valid upload credentials if a credentials file is configured
+func (c *Config) authenticateUpload(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.credentials == nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		credential, ok := c.credentials.Authenticate(r)
+		if !ok {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="transfer"`)
+			w.Header().Add("WWW-Authenticate", `Basic realm="transfer"`)
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(auth.WithCredential(r.Context(), credential)))
+	}
+}
+
+// quotaReservation - quota held by one upload while its content is streamed
+type quotaReservation struct {
+	// uploader - authenticated uploader, empty for anonymous uploads which are not accounted
+	uploader string
+	bytes    int64
+	// limit - maximum number of bytes the upload may send
+	limit int64
+}
+
+// reserveQuota - check an upload of size bytes (-1 if unknown) against the upload limit and hold the quota of the
+// authenticated uploader before the content is streamed, so that concurrent uploads cannot exceed it together.
+// Returns a http status code other than 200 if the upload is not allowed.
+func (c *Config) reserveQuota(ctx context.Context, size int64) (quotaReservation, int) {
+	reservation := quotaReservation{limit: p.UploadLimitGB * metrics.GB}
+	if size > reservation.limit {
+		return quotaReservation{}, http.StatusRequestEntityTooLarge
+	}
+	credential, ok := auth.FromContext(ctx)
+	if !ok {
+		return reservation, http.StatusOK
+	}
+	var status int
+	if reservation.bytes, status = c.quota.reserve(credential.Name, size, credential.MaxBytes, credential.MaxFiles); status != http.StatusOK {
+		return quotaReservation{}, status
+	}
+	reservation.uploader = credential.Name
+	if credential.MaxBytes > 0 {
+		reservation.limit = min(reservation.limit, reservation.bytes)
+	}
+	return reservation, http.StatusOK
+}
+
+// commitQuota - account the stored file of size bytes the reservation was made for
+func (c *Config) commitQuota(reservation quotaReservation, size int64) {
+	if reservation.uploader != "" {
+		c.quota.commit(reservation.uploader, reservation.bytes, size)
+	}
+}
+
+// releaseQuota - return the quota held for a failed upload
+func (c *Config) releaseQuota(reservation quotaReservation) {
+	if reservation.uploader != "" {
+		c.quota.release(reservation.uploader, reservation.bytes)
+	}
+}
+
+// releaseStoredQuota - return the quota of a deleted file of uploader
+func (c *Config) releaseStoredQuota(uploader string, size int64) {
+	if uploader != "" {
+		c.quota.remove(uploader, size)
+	}
+}
+
+// writeQuotaError - respond to an upload rejected by reserveQuota
+func writeQuotaError(w http.ResponseWriter, status int) {
+	if status == http.StatusRequestEntityTooLarge {
+		sentry.CaptureMessage("upload too large")
+		http.Error(w, "upload too large", status)
+		return
+	}
+	http.Error(w, "file quota exceeded", status)
+}
+
+// recordUpload - account a stored file in the metrics
+func (c *Config) recordUpload(options uploadOptions, size int64) {
+	metrics.ObjectSize.Observe(float64(size))
+	metrics.ObjectAction.With(prometheus.Labels{metrics.LabelAction: "upload"}).Inc()
+	if options.uploader != "" {
+		metrics.UploaderBytes.With(prometheus.Labels{metrics.LabelUploader: options.uploader}).Add(float64(size))
+		metrics.UploaderObjects.With(prometheus.Labels{metrics.LabelUploader: options.uploader}).Inc()
+	}
+}
+
+// refreshQuotaUsage - recalculate the usage of all uploaders from the stored objects
+func (c *Config) refreshQuotaUsage(ctx context.Context) error {
+	current := make(map[string]usage)
+	for listed, err := range c.storage.List(ctx, "") {
+		if err != nil {
+			return err
+		}
+		// listings of s3 do not contain user metadata
+		object, err := c.storage.Stat(ctx, listed.Key)
+		if err != nil {
+			continue
+		}
+		if uploader := object.UserMetadata[UploaderMetadataFieldName]; uploader != "" && !objectGone(object, time.Now()) {
+			current[uploader] = usage{bytes: current[uploader].bytes + object.Size, files: current[uploader].files + 1}
+		}
+	}
+	c.quota.replace(current)
+	return nil
+}
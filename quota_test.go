@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"transfer/internal/auth"
+)
+
+func TestAuthenticatedUploadQuota(t *testing.T) {
+	server, c := newTestServer(t)
+	c.credentials = auth.Credentials{
+		{Name: "ci", Token: "secret", MaxFiles: 2, MaxBytes: 10},
+	}
+
+	upload := func(authorization string, content string) int {
+		request := mustRequest(t, http.MethodPut, server.URL+"/file.txt", strings.NewReader(content))
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	if status := upload("", "content"); status != http.StatusUnauthorized {
+		t.Errorf("anonymous upload returned %d", status)
+	}
+	if status := upload("Bearer wrong", "content"); status != http.StatusUnauthorized {
+		t.Errorf("upload with wrong token returned %d", status)
+	}
+	if status := upload("Bearer secret", "1234567"); status != http.StatusOK {
+		t.Fatalf("authenticated upload returned %d", status)
+	}
+	if status := upload("Bearer secret", "1234"); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload exceeding the byte quota returned %d", status)
+	}
+	if status := upload("Bearer secret", "123"); status != http.StatusOK {
+		t.Errorf("upload within the byte quota returned %d", status)
+	}
+	if status := upload("Bearer secret", ""); status != http.StatusForbidden {
+		t.Errorf("upload exceeding the file quota returned %d", status)
+	}
+
+	for object, err := range c.storage.List(context.Background(), "") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if object.UserMetadata[UploaderMetadataFieldName] != "ci" {
+			t.Errorf("uploader not recorded for %+q", object.Key)
+		}
+	}
+
+	// usage is rebuilt from the stored objects
+	c.quota.replace(nil)
+	if err := c.refreshQuotaUsage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if current := c.quota.get("ci"); current.files != 2 || current.bytes != 10 {
+		t.Errorf("unexpected usage after refresh: %+v", current)
+	}
+}
+
+func TestQuotaReservedWhileUploading(t *testing.T) {
+	server, c := newTestServer(t)
+	c.credentials = auth.Credentials{
+		{Name: "ci", Token: "secret", MaxFiles: 2, MaxBytes: 10},
+	}
+	authorization := map[string]string{"Authorization": "Bearer secret"}
+
+	put := func(content string) *http.Response {
+		request := mustRequest(t, http.MethodPut, server.URL+"/file.txt", strings.NewReader(content))
+		request.Header.Set("Authorization", "Bearer secret")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response
+	}
+
+	// an unfinished resumable upload holds its quota
+	created := tusRequest(t, http.MethodPost, server.URL+"/files/", map[string]string{
+		"Authorization":   authorization["Authorization"],
+		"Upload-Length":   "8",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("large.bin")),
+	}, nil)
+	if created.StatusCode != http.StatusCreated {
+		t.Fatalf("creation failed with status %d", created.StatusCode)
+	}
+	if response := put("12345"); response.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload exceeding the reserved quota returned %d", response.StatusCode)
+	}
+	if response := tusRequest(t, http.MethodDelete, created.Header.Get("Location"), authorization, nil); response.StatusCode != http.StatusNoContent {
+		t.Fatalf("termination returned %d", response.StatusCode)
+	}
+
+	// deleted files return their quota
+	response := put("12345")
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("upload after termination returned %d", response.StatusCode)
+	}
+	if status, _ := doRequest(t, http.MethodDelete, response.Header.Get(deleteLinkHeader), nil); status != http.StatusNoContent {
+		t.Fatalf("deletion returned %d", status)
+	}
+	for _, content := range []string{"1234567890", ""} {
+		if response := put(content); response.StatusCode != http.StatusOK {
+			t.Errorf("upload of %d bytes after deletion returned %d", len(content), response.StatusCode)
+		}
+	}
+	if current := c.quota.get("ci"); current.files != 2 || current.bytes != 10 {
+		t.Errorf("unexpected usage %+v", current)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"time"
+
+	"transfer/internal/storage"
+)
+
+// parseRetention - interpret a Max-Days header value as number of days or as duration like "36h"
+func parseRetention(value string) (time.Duration, error) {
+	var retention time.Duration
+	if days, err := strconv.ParseFloat(value, 64); err == nil {
+		retention = time.Duration(days * float64(24*time.Hour))
+	} else if retention, err = time.ParseDuration(value); err != nil {
+		return 0, fmt.Errorf("invalid Max-Days %+q", value)
+	}
+	if retention <= 0 {
+		return 0, errors.New("max-days must be positive")
+	}
+	return retention, nil
+}
+
+// objectExpiry - time when the object is due for deletion. Objects without expiry metadata use the default retention.
+func objectExpiry(object storage.Object) time.Time {
+	if expiry, err := time.Parse(time.RFC3339, object.UserMetadata[ExpiryMetadataFieldName]); err == nil {
+		return expiry
+	}
+	return objectUploaded(object).Add(p.RetentionDefault)
+}
+
+// objectUploaded - time of the upload of the object, its last modification for objects stored without it
+func objectUploaded(object storage.Object) time.Time {
+	if uploaded, err := time.Parse(time.RFC3339, object.UserMetadata[UploadedMetadataFieldName]); err == nil {
+		return uploaded
+	}
+	return object.LastModified
+}
+
+// remainingDownloads - number of downloads left for the object, -1 if unlimited
+func remainingDownloads(object storage.Object) int {
+	maxDownloads, err := strconv.Atoi(object.UserMetadata[MaxDownloadsMetadataFieldName])
+	if err != nil {
+		return -1
+	}
+	downloads, _ := strconv.Atoi(object.UserMetadata[DownloadsMetadataFieldName])
+	return max(maxDownloads-downloads, 0)
+}
+
+// errDownloadsExhausted - the download limit of the object was reached by other downloads
+var errDownloadsExhausted = errors.New("no downloads remaining")
+
+// objectGone - object expired or reached its download limit
+func objectGone(object storage.Object, now time.Time) bool {
+	return objectExpiry(object).Before(now) || remainingDownloads(object) == 0
+}
+
+// claimDownload - count a download of an object with a download limit before its content is sent. Claims are
+// serialized per key and based on the current metadata, so that concurrent downloads neither lose increments nor
+// exceed the limit; errDownloadsExhausted is returned if no download remains.
+func (c *Config) claimDownload(ctx context.Context, object storage.Object) error {
+	if remainingDownloads(object) < 0 {
+		return nil
+	}
+	unlock := c.downloadLocks.lock(object.Key)
+	defer unlock()
+	object, err := c.storage.Stat(ctx, object.Key)
+	if err != nil {
+		return err
+	}
+	if remainingDownloads(object) == 0 {
+		return errDownloadsExhausted
+	}
+	downloads, _ := strconv.Atoi(object.UserMetadata[DownloadsMetadataFieldName])
+	metadata := maps.Clone(object.UserMetadata)
+	metadata[DownloadsMetadataFieldName] = strconv.Itoa(downloads + 1)
+	return c.storage.SetMetadata(ctx, object.Key, metadata)
+}
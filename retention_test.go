@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"transfer/internal/storage"
+)
+
+func Test_parseUploadOptions(t *testing.T) {
+	p = Parameters{
+		RetentionDefault:      time.Hour,
+		RetentionMin:          time.Minute,
+		RetentionMax:          7 * 24 * time.Hour,
+		RetentionMaxDownloads: 10,
+	}
+	for _, test := range []struct {
+		Name                 string
+		Headers              map[string]string
+		ExpectedRetention    time.Duration
+		ExpectedMaxDownloads int
+		ExpectError          bool
+	}{
+		{
+			Name:                 "defaults",
+			ExpectedRetention:    time.Hour,
+			ExpectedMaxDownloads: 10,
+		},
+		{
+			Name:                 "days",
+			Headers:              map[string]string{"Max-Days": "2", "Max-Downloads": "3"},
+			ExpectedRetention:    48 * time.Hour,
+			ExpectedMaxDownloads: 3,
+		},
+		{
+			Name:                 "duration",
+			Headers:              map[string]string{"Max-Days": "90m"},
+			ExpectedRetention:    90 * time.Minute,
+			ExpectedMaxDownloads: 10,
+		},
+		{
+			Name:                 "bounded by server limits",
+			Headers:              map[string]string{"Max-Days": "30", "Max-Downloads": "100"},
+			ExpectedRetention:    7 * 24 * time.Hour,
+			ExpectedMaxDownloads: 10,
+		},
+		{
+			Name:                 "raised to minimum",
+			Headers:              map[string]string{"Max-Days": "1s"},
+			ExpectedRetention:    time.Minute,
+			ExpectedMaxDownloads: 10,
+		},
+		{
+			Name:        "invalid retention",
+			Headers:     map[string]string{"Max-Days": "forever"},
+			ExpectError: true,
+		},
+		{
+			Name:        "invalid download limit",
+			Headers:     map[string]string{"Max-Downloads": "0"},
+			ExpectError: true,
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodPut, "/file", nil)
+			for key, value := range test.Headers {
+				request.Header.Set(key, value)
+			}
+			start := time.Now().Truncate(time.Second)
+			options, err := parseUploadOptions(request)
+			if (err != nil) != test.ExpectError {
+				t.Fatalf("unexpected error state: %v", err)
+			}
+			if test.ExpectError {
+				return
+			}
+			if retention := options.expiry.Sub(start); retention < test.ExpectedRetention || retention > test.ExpectedRetention+time.Second {
+				t.Errorf("%v is expected but %v is resulting", test.ExpectedRetention, retention)
+			}
+			if options.maxDownloads != test.ExpectedMaxDownloads {
+				t.Errorf("%d downloads are expected but %d are resulting", test.ExpectedMaxDownloads, options.maxDownloads)
+			}
+		})
+	}
+}
+
+func TestMaxDownloads(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	request, _ := http.NewRequest(http.MethodPut, server.URL+"/once.txt", strings.NewReader("content"))
+	request.Header.Set("Max-Downloads", "1")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.Header.Get("Max-Downloads") != "1" || response.Header.Get("X-Expires") == "" {
+		t.Errorf("effective options are not echoed: %v", response.Header)
+	}
+	link := strings.TrimSpace(string(body))
+
+	// HEAD requests do not count as download
+	for _, expected := range []int{http.StatusOK, http.StatusGone} {
+		if status, _ := doRequest(t, http.MethodHead, link, nil); status != expected {
+			t.Errorf("HEAD returned %d, expected %d", status, expected)
+		}
+		if status, _ := doRequest(t, http.MethodGet, link, nil); status != expected {
+			t.Errorf("GET returned %d, expected %d", status, expected)
+		}
+	}
+}
+
+func TestMaxDownloadsCountsRangeRequests(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	request := mustRequest(t, http.MethodPut, server.URL+"/twice.txt", strings.NewReader("content"))
+	request.Header.Set("Max-Downloads", "2")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	link := strings.TrimSpace(string(body))
+
+	// fetching the file in pieces uses up the downloads as well
+	for _, ranges := range []string{"bytes=1-", "bytes=0-0"} {
+		request := mustRequest(t, http.MethodGet, link, nil)
+		request.Header.Set("Range", ranges)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusPartialContent {
+			t.Errorf("range %s returned %d", ranges, response.StatusCode)
+		}
+	}
+	if status, _ := doRequest(t, http.MethodGet, link, nil); status != http.StatusGone {
+		t.Errorf("GET after the limit returned %d", status)
+	}
+}
+
+func TestConcurrentDownloadCounting(t *testing.T) {
+	_, c := newTestServer(t)
+	ctx := context.Background()
+	object, err := c.storage.Put(ctx, "id/file", strings.NewReader("content"), 7, storage.PutOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.storage.SetMetadata(ctx, object.Key, map[string]string{MaxDownloadsMetadataFieldName: "100", DownloadsMetadataFieldName: "0"}); err != nil {
+		t.Fatal(err)
+	}
+	object, _ = c.storage.Stat(ctx, object.Key)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if err := c.claimDownload(ctx, object); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+	if object, _ = c.storage.Stat(ctx, object.Key); remainingDownloads(object) != 80 {
+		t.Errorf("%d downloads remaining after 20 counted downloads", remainingDownloads(object))
+	}
+}
+
+// slowBackend - storage taking a while to deliver content, so that concurrent downloads overlap
+type slowBackend struct {
+	storage.Backend
+}
+
+func (s slowBackend) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	time.Sleep(20 * time.Millisecond)
+	return s.Backend.Get(ctx, key)
+}
+
+func TestConcurrentDownloadsRespectLimit(t *testing.T) {
+	server, c := newTestServer(t)
+	c.storage = slowBackend{c.storage}
+
+	request := mustRequest(t, http.MethodPut, server.URL+"/once.txt", strings.NewReader("content"))
+	request.Header.Set("Max-Downloads", "1")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	link := strings.TrimSpace(string(body))
+
+	var mutex sync.Mutex
+	statuses := make(map[int]int)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			response, err := http.Get(link)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+			mutex.Lock()
+			statuses[response.StatusCode]++
+			mutex.Unlock()
+		})
+	}
+	wg.Wait()
+	if statuses[http.StatusOK] != 1 || statuses[http.StatusGone] != 9 {
+		t.Errorf("expected one download and nine rejections, got %v", statuses)
+	}
+}
+
+func Test_objectUploaded(t *testing.T) {
+	uploaded := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	modified := uploaded.Add(72 * time.Hour)
+	for _, test := range []struct {
+		Name     string
+		Object   storage.Object
+		Expected time.Time
+	}{
+		{
+			Name: "metadata changed after the upload",
+			Object: storage.Object{
+				LastModified: modified,
+				UserMetadata: map[string]string{UploadedMetadataFieldName: uploaded.Format(time.RFC3339)},
+			},
+			Expected: uploaded,
+		},
+		{
+			Name:     "stored without upload time",
+			Object:   storage.Object{LastModified: modified},
+			Expected: modified,
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			if result := objectUploaded(test.Object); !result.Equal(test.Expected) {
+				t.Errorf("%v is expected but %v is resulting", test.Expected, result)
+			}
+		})
+	}
+}
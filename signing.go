@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"transfer/internal/encryption"
+)
+
+// minSigningKeyLength - shortest accepted key for signing download links
+const minSigningKeyLength = 16
+
+// linkSigner - creates and verifies download links carrying an expiry and HMAC signature. The first key signs new
+// links, all keys are accepted for verification to allow key rotation.
+type linkSigner struct {
+	keys [][]byte
+	// ttl - lifetime of new links; links never outlive the file if 0
+	ttl time.Duration
+}
+
+// loadSigningKeys - collect signing keys from the flag values and the optional key file with one key per line
+func loadSigningKeys(keys []string, keyFile string) ([][]byte, error) {
+	if keyFile != "" {
+		file, err := os.Open(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+				keys = append(keys, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	signingKeys := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if len(key) < minSigningKeyLength {
+			return nil, fmt.Errorf("signing keys must be at least %d characters long", minSigningKeyLength)
+		}
+		signingKeys = append(signingKeys, []byte(key))
+	}
+	return signingKeys, nil
+}
+
+// signature - HMAC of resource and expiry using key
+func (s *linkSigner) signature(key []byte, resource string, expires int64) []byte {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%d", resource, expires)
+	return mac.Sum(nil)
+}
+
+// sign - query parameters authorizing access to resource until expires
+func (s *linkSigner) sign(resource string, expires time.Time) url.Values {
+	if limit := time.Now().Add(s.ttl); s.ttl > 0 && (expires.IsZero() || limit.Before(expires)) {
+		expires = limit
+	}
+	return url.Values{
+		"expires":   {strconv.FormatInt(expires.Unix(), 10)},
+		"signature": {base64.RawURLEncoding.EncodeToString(s.signature(s.keys[0], resource, expires.Unix()))},
+	}
+}
+
+// verify - http status describing whether query authorizes access to resource at now
+func (s *linkSigner) verify(resource string, query url.Values, now time.Time) int {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return http.StatusForbidden
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(query.Get("signature"))
+	if err != nil {
+		return http.StatusForbidden
+	}
+	for _, key := range s.keys {
+		if hmac.Equal(signature, s.signature(key, resource, expires)) {
+			if now.Unix() > expires {
+				return http.StatusGone
+			}
+			return http.StatusOK
+		}
+	}
+	return http.StatusForbidden
+}
+
+// signedDownloadLink - download link of <id>/<filename>, signed if link signing is enabled. Links of encrypted files
+// carry their key.
+func (c *Config) signedDownloadLink(r *http.Request, id string, filename string, expires time.Time, key *encryption.Key) string {
+	link := downloadLink(r, id, filename)
+	if key != nil {
+		link = downloadLink(r, id, key.String()+"/"+filename)
+	}
+	if c.signer == nil {
+		return link
+	}
+	return link + "?" + c.signer.sign(id+"/"+filename, expires).Encode()
+}
+
+// signedListLink - link listing all files of upload id, signed if link signing is enabled. The query parameters of
+// signed links authorize the bundle downloads of the id as well.
+func (c *Config) signedListLink(r *http.Request, id string, expires time.Time) string {
+	link := downloadLink(r, id, "")
+	if c.signer == nil {
+		return link
+	}
+	return link + "?" + c.signer.sign(id, expires).Encode()
+}
+
+// rejectUnsignedRequest - write an error response if link signing is enabled and the request is not authorized
+// for resource
+func (c *Config) rejectUnsignedRequest(w http.ResponseWriter, r *http.Request, resource string) bool {
+	if c.signer == nil {
+		return false
+	}
+	switch c.signer.verify(resource, r.URL.Query(), time.Now()) {
+	case http.StatusOK:
+		return false
+	case http.StatusGone:
+		http.Error(w, "link expired", http.StatusGone)
+	default:
+		http.Error(w, "invalid link signature", http.StatusForbidden)
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLinkSignerVerify(t *testing.T) {
+	oldKey, newKey := []byte("old-signing-key-0123"), []byte("new-signing-key-0123")
+	now := time.Now()
+	signed := (&linkSigner{keys: [][]byte{oldKey}}).sign("id/file", now.Add(time.Hour))
+
+	tampered := url.Values{"expires": {"9999999999"}, "signature": signed["signature"]}
+
+	tests := []struct {
+		Name     string
+		Keys     [][]byte
+		Resource string
+		Query    url.Values
+		Now      time.Time
+		Expected int
+	}{
+		{Name: "valid", Keys: [][]byte{oldKey}, Resource: "id/file", Query: signed, Now: now, Expected: http.StatusOK},
+		{Name: "rotated key", Keys: [][]byte{newKey, oldKey}, Resource: "id/file", Query: signed, Now: now, Expected: http.StatusOK},
+		{Name: "retired key", Keys: [][]byte{newKey}, Resource: "id/file", Query: signed, Now: now, Expected: http.StatusForbidden},
+		{Name: "other resource", Keys: [][]byte{oldKey}, Resource: "id/other", Query: signed, Now: now, Expected: http.StatusForbidden},
+		{Name: "extended expiry", Keys: [][]byte{oldKey}, Resource: "id/file", Query: tampered, Now: now, Expected: http.StatusForbidden},
+		{Name: "missing", Keys: [][]byte{oldKey}, Resource: "id/file", Query: url.Values{}, Now: now, Expected: http.StatusForbidden},
+		{Name: "expired", Keys: [][]byte{oldKey}, Resource: "id/file", Query: signed, Now: now.Add(2 * time.Hour), Expected: http.StatusGone},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			signer := &linkSigner{keys: test.Keys}
+			if status := signer.verify(test.Resource, test.Query, test.Now); status != test.Expected {
+				t.Errorf("expected status %d, got %d", test.Expected, status)
+			}
+		})
+	}
+}
+
+func TestSignedDownloadLink(t *testing.T) {
+	server, c := newTestServer(t)
+	c.signer = &linkSigner{keys: [][]byte{[]byte("test-signing-key-0123")}, ttl: time.Minute}
+
+	status, link := doRequest(t, http.MethodPut, server.URL+"/hello.txt", strings.NewReader("signed"))
+	if status != http.StatusOK {
+		t.Fatalf("upload failed with status %d: %s", status, link)
+	}
+	link = strings.TrimSpace(link)
+
+	if status, body := doRequest(t, http.MethodGet, link, nil); status != http.StatusOK || body != "signed" {
+		t.Errorf("signed download returned %d %+q", status, body)
+	}
+	unsigned, _, _ := strings.Cut(link, "?")
+	if status, _ := doRequest(t, http.MethodGet, unsigned, nil); status != http.StatusForbidden {
+		t.Errorf("unsigned download returned %d", status)
+	}
+}
+
+func TestSignedListLink(t *testing.T) {
+	server, c := newTestServer(t)
+	c.signer = &linkSigner{keys: [][]byte{[]byte("test-signing-key-0123")}, ttl: time.Minute}
+
+	response, err := http.DefaultClient.Do(mustRequest(t, http.MethodPut, server.URL+"/hello.txt", strings.NewReader("signed")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	listLink := response.Header.Get(listLinkHeader)
+	if response.StatusCode != http.StatusOK || listLink == "" {
+		t.Fatalf("upload returned %d without list link", response.StatusCode)
+	}
+
+	if status, body := doRequest(t, http.MethodGet, listLink, nil); status != http.StatusOK || !strings.Contains(body, "/hello.txt?") {
+		t.Errorf("signed listing returned %d %+q", status, body)
+	}
+	unsigned, query, _ := strings.Cut(listLink, "?")
+	bundle := strings.TrimSuffix(unsigned, "/") + ".zip"
+	if status, _ := doRequest(t, http.MethodGet, bundle+"?"+query, nil); status != http.StatusOK {
+		t.Errorf("signed bundle returned %d", status)
+	}
+	for _, link := range []string{unsigned, bundle} {
+		if status, _ := doRequest(t, http.MethodGet, link, nil); status != http.StatusForbidden {
+			t.Errorf("unsigned %s returned %d", link, status)
+		}
+	}
+}
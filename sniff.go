@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+)
+
+const (
+	// sniffLength - number of leading bytes inspected to detect the type of uploaded content
+	sniffLength = 512
+
+	// contentTypeSourceAuto - use the sniffed type unless the extension is more specific
+	contentTypeSourceAuto = "auto"
+	// contentTypeSourceExtension - use the type derived from the file extension if it is known
+	contentTypeSourceExtension = "extension"
+	// contentTypeSourceContent - use the sniffed type if it is more than generic binary data
+	contentTypeSourceContent = "content"
+)
+
+// magicNumber - signature identifying a file format at a fixed offset
+type magicNumber struct {
+	offset      int
+	signature   string
+	contentType string
+}
+
+// magicNumbers - formats not recognized by http.DetectContentType, checked before it
+var magicNumbers = []magicNumber{
+	{offset: 257, signature: "ustar", contentType: "application/x-tar"},
+	{signature: "BZh", contentType: "application/x-bzip2"},
+	{signature: "\xFD7zXZ\x00", contentType: "application/x-xz"},
+	{signature: "\x28\xB5\x2F\xFD", contentType: "application/zstd"},
+	{signature: "7z\xBC\xAF\x27\x1C", contentType: "application/x-7z-compressed"},
+	{signature: "\x04\x22\x4D\x18", contentType: "application/x-lz4"},
+	{signature: "\x7FELF", contentType: "application/x-elf"},
+	{signature: "II*\x00", contentType: "image/tiff"},
+	{signature: "MM\x00*", contentType: "image/tiff"},
+	{offset: 4, signature: "ftypavif", contentType: "image/avif"},
+	{offset: 4, signature: "ftypheic", contentType: "image/heic"},
+	{offset: 4, signature: "ftypqt  ", contentType: "video/quicktime"},
+	{signature: "fLaC", contentType: "audio/flac"},
+	{signature: "SQLite format 3\x00", contentType: "application/vnd.sqlite3"},
+}
+
+// containerTypes - generic formats whose more specific variants (docx, jar, apk, tgz, ...) are only told apart by
+// their extension
+var containerTypes = []string{"application/zip", "application/x-gzip", "application/gzip"}
+
+// sniffContentType - content type detected from the first bytes of a file
+func sniffContentType(prefix []byte) string {
+	for _, magic := range magicNumbers {
+		if len(prefix) >= magic.offset && bytes.HasPrefix(prefix[magic.offset:], []byte(magic.signature)) {
+			return magic.contentType
+		}
+	}
+	return http.DetectContentType(prefix)
+}
+
+// genericContentType - whether contentType does not tell more than that the content is binary or text
+func genericContentType(contentType string) bool {
+	switch mediaType(contentType) {
+	case "", "application/octet-stream", "text/plain":
+		return true
+	}
+	return false
+}
+
+// reconcileContentType - choose between the type derived from the extension and the sniffed one
+func reconcileContentType(byExtension string, sniffed string) string {
+	switch p.ContentTypeSource {
+	case contentTypeSourceExtension:
+		if mediaType(byExtension) != "application/octet-stream" {
+			return byExtension
+		}
+		return sniffed
+	case contentTypeSourceContent:
+		if mediaType(sniffed) != "application/octet-stream" {
+			return sniffed
+		}
+		return byExtension
+	}
+	// a known extension refines generic sniffing results and containers, e.g. a docx is sniffed as a zip
+	if genericContentType(sniffed) || slices.Contains(containerTypes, mediaType(sniffed)) {
+		if mediaType(byExtension) != "application/octet-stream" {
+			return byExtension
+		}
+	}
+	return sniffed
+}
+
+// inspectContent - detect the content type and client encryption of an upload from the start of body, which is
+// returned with the inspected bytes still unread
+func inspectContent(filename string, body io.Reader) (string, string, io.Reader, error) {
+	buffered := bufio.NewReaderSize(body, sniffLength)
+	prefix, err := buffered.Peek(sniffLength)
+	if err != nil && err != io.EOF {
+		return "", "", buffered, err
+	}
+	contentType, clientEncryption, err := detectContent(filename, prefix)
+	return contentType, clientEncryption, buffered, err
+}
+
+// detectContent - content type and client encryption of an upload starting with prefix, which holds the first
+// sniffLength bytes or the whole content of shorter uploads
+func detectContent(filename string, prefix []byte) (string, string, error) {
+	clientEncryption, err := detectClientEncryption(prefix)
+	if err != nil {
+		return "", "", err
+	}
+	// the ciphertext does not reveal anything about the plaintext
+	if clientEncryption != "" {
+		return "application/octet-stream", clientEncryption, nil
+	}
+	return reconcileContentType(selectContentType(filename), sniffContentType(prefix)), clientEncryption, nil
+}
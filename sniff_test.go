@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_sniffContentType(t *testing.T) {
+	tarHeader := make([]byte, 512)
+	copy(tarHeader[257:], "ustar\x0000")
+
+	for _, test := range []struct {
+		Name     string
+		Content  []byte
+		Expected string
+	}{
+		{Name: "png", Content: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), Expected: "image/png"},
+		{Name: "pdf", Content: []byte("%PDF-1.7\n"), Expected: "application/pdf"},
+		{Name: "zip", Content: []byte("PK\x03\x04\x14\x00"), Expected: "application/zip"},
+		{Name: "tar", Content: tarHeader, Expected: "application/x-tar"},
+		{Name: "xz", Content: []byte("\xFD7zXZ\x00\x00\x04"), Expected: "application/x-xz"},
+		{Name: "zstd", Content: []byte("\x28\xB5\x2F\xFD\x04\x00"), Expected: "application/zstd"},
+		{Name: "avif", Content: []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00"), Expected: "image/avif"},
+		{Name: "text", Content: []byte("hello transfer"), Expected: "text/plain; charset=utf-8"},
+		{Name: "empty", Content: nil, Expected: "text/plain; charset=utf-8"},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			if result := sniffContentType(test.Content); result != test.Expected {
+				t.Errorf("%+q is expected but %+q is resulting", test.Expected, result)
+			}
+		})
+	}
+}
+
+func Test_reconcileContentType(t *testing.T) {
+	for _, test := range []struct {
+		Name        string
+		Source      string
+		ByExtension string
+		Sniffed     string
+		Expected    string
+	}{
+		{Name: "auto prefers sniffed type", Source: contentTypeSourceAuto, ByExtension: "text/plain; charset=utf-8", Sniffed: "text/html; charset=utf-8", Expected: "text/html; charset=utf-8"},
+		{Name: "auto refines generic text", Source: contentTypeSourceAuto, ByExtension: "text/csv; charset=utf-8", Sniffed: "text/plain; charset=utf-8", Expected: "text/csv; charset=utf-8"},
+		{Name: "auto refines containers", Source: contentTypeSourceAuto, ByExtension: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", Sniffed: "application/zip", Expected: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{Name: "auto without extension", Source: contentTypeSourceAuto, ByExtension: "application/octet-stream", Sniffed: "image/png", Expected: "image/png"},
+		{Name: "extension wins", Source: contentTypeSourceExtension, ByExtension: "image/jpeg", Sniffed: "image/png", Expected: "image/jpeg"},
+		{Name: "extension unknown", Source: contentTypeSourceExtension, ByExtension: "application/octet-stream", Sniffed: "image/png", Expected: "image/png"},
+		{Name: "content wins", Source: contentTypeSourceContent, ByExtension: "text/csv; charset=utf-8", Sniffed: "text/plain; charset=utf-8", Expected: "text/plain; charset=utf-8"},
+		{Name: "content unknown", Source: contentTypeSourceContent, ByExtension: "image/png", Sniffed: "application/octet-stream", Expected: "image/png"},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			p = Parameters{ContentTypeSource: test.Source}
+			if result := reconcileContentType(test.ByExtension, test.Sniffed); result != test.Expected {
+				t.Errorf("%+q is expected but %+q is resulting", test.Expected, result)
+			}
+		})
+	}
+}
+
+func Test_inspectContent(t *testing.T) {
+	p = Parameters{ContentTypeSource: contentTypeSourceAuto}
+	content := "%PDF-1.7\n" + strings.Repeat("x", 2*sniffLength)
+
+	contentType, clientEncryption, body, err := inspectContent("document.txt", strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/pdf" || clientEncryption != "" {
+		t.Errorf("detected %+q %+q", contentType, clientEncryption)
+	}
+	if read, err := io.ReadAll(body); err != nil || string(read) != content {
+		t.Errorf("inspected content was not returned unchanged: %v", err)
+	}
+
+	contentType, clientEncryption, _, err = inspectContent("image.png", strings.NewReader(ageMagic+"-> X25519 abc\n"))
+	if err != nil || contentType != "application/octet-stream" || clientEncryption != clientEncryptionAge {
+		t.Errorf("age encrypted content detected as %+q %+q: %v", contentType, clientEncryption, err)
+	}
+}
+
+func TestUploadStoresSniffedContentType(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	request := mustRequest(t, http.MethodPut, server.URL+"/image.bin", bytes.NewReader([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")))
+	request.Header.Set("Accept", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var result uploadResult
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.ContentType != "image/png" {
+		t.Errorf("upload stored content type %+q", result.ContentType)
+	}
+}
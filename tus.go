@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bonsai-oss/mux"
+	"github.com/getsentry/sentry-go"
+	"github.com/google/uuid"
+
+	"transfer/internal/metrics"
+	"transfer/internal/storage"
+)
+
+const (
+	// tusVersion - implemented version of the tus resumable upload protocol
+	tusVersion = "1.0.0"
+	// tusExtensions - implemented tus protocol extensions
+	tusExtensions = "creation,termination,expiration"
+	// tusPartSize - amount of received bytes collected before they are stored as one multipart upload part
+	tusPartSize = 8 * metrics.MB
+	// tusOffsetContentType - required content type of PATCH requests
+	tusOffsetContentType = "application/offset+octet-stream"
+	// downloadLinkHeader - response header carrying the download link of completed tus uploads
+	downloadLinkHeader = "X-Url-Download"
+)
+
+// tusUpload - state of a resumable upload
+type tusUpload struct {
+	// patchLock - serializes requests modifying the upload content
+	patchLock sync.Mutex
+	// mutex - protects the fields below against concurrent HEAD requests
+	mutex sync.Mutex
+	// tusID - id of the resumable upload in /files/ urls; it differs from the download id so that download links do
+	// not grant access to the upload
+	tusID    string
+	id       string
+	filename string
+	// contentType - type detected from the filename and the start of the content
+	contentType string
+	metadata    string
+	length      int64
+	offset      int64
+	expires     time.Time
+	finished    bool
+	options     uploadOptions
+	// reservation - quota held until the upload is finished or discarded
+	reservation quotaReservation
+
+	// multipartID - id of the backend multipart upload, created with the first full part
+	multipartID string
+	parts       []storage.Part
+	buffer      bytes.Buffer
+	checksum    hash.Hash
+	// cipher - encrypts the received content at the current offset, nil if encryption is disabled
+	cipher cipher.Stream
+	// prefix - start of the content collected across PATCH requests until it is inspected
+	prefix    []byte
+	inspected bool
+}
+
+func (u *tusUpload) key() string {
+	return u.id + "/" + u.filename
+}
+
+// tusRegistry - resumable uploads known to this instance
+type tusRegistry struct {
+	mutex   sync.Mutex
+	uploads map[string]*tusUpload
+}
+
+func (t *tusRegistry) add(upload *tusUpload) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.uploads == nil {
+		t.uploads = make(map[string]*tusUpload)
+	}
+	t.uploads[upload.tusID] = upload
+}
+
+func (t *tusRegistry) get(id string) *tusUpload {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.uploads[id]
+}
+
+func (t *tusRegistry) remove(id string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.uploads, id)
+}
+
+// expired - uploads with an expiration date before now
+func (t *tusRegistry) expired(now time.Time) []*tusUpload {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var uploads []*tusUpload
+	for _, upload := range t.uploads {
+		upload.mutex.Lock()
+		if upload.expires.Before(now) {
+			uploads = append(uploads, upload)
+		}
+		upload.mutex.Unlock()
+	}
+	return uploads
+}
+
+// parseTusMetadata - decode the Upload-Metadata header consisting of comma separated "key base64(value)" pairs
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, encodedValue, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(encodedValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for metadata key %+q: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// tusMiddleware - add protocol headers and reject requests of unsupported protocol versions
+func tusMiddleware(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			http.Error(w, "unsupported tus version", http.StatusPreconditionFailed)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// multipartBackend - storage backend if it is capable of multipart uploads; writes an error response otherwise
+func (c *Config) multipartBackend(w http.ResponseWriter) (storage.MultipartBackend, bool) {
+	backend, ok := c.storage.(storage.MultipartBackend)
+	if !ok {
+		http.Error(w, "resumable uploads are not supported by the storage backend", http.StatusNotImplemented)
+	}
+	return backend, ok
+}
+
+// lookupTusUpload - find the upload addressed by the request; writes an error response if it does not exist
+func (c *Config) lookupTusUpload(w http.ResponseWriter, r *http.Request) *tusUpload {
+	upload := c.tusUploads.get(mux.Vars(r)["id"])
+	if upload == nil {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return nil
+	}
+	upload.mutex.Lock()
+	expired := !upload.finished && upload.expires.Before(time.Now())
+	upload.mutex.Unlock()
+	if expired {
+		http.Error(w, "upload expired", http.StatusGone)
+		return nil
+	}
+	return upload
+}
+
+func (c *Config) TusOptionsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(p.UploadLimitGB*metrics.GB, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Config) TusCreateHandler(w http.ResponseWriter, r *http.Request) {
+	handlerMainSpan := sentry.StartSpan(r.Context(), "handler.tus.create")
+	defer handlerMainSpan.Finish()
+
+	if cancelRequestIfUnhealthy(w) {
+		return
+	}
+	if _, ok := c.multipartBackend(w); !ok {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filename := sanitizeFilename(metadata["filename"])
+	if filename == "" {
+		http.Error(w, "filename not provided", http.StatusBadRequest)
+		return
+	}
+	options, err := parseUploadOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	options.originalFilename = displayFilename(metadata["filename"])
+	// the quota is held until the upload is finished or discarded
+	reservation, status := c.reserveQuota(r.Context(), length)
+	if status != http.StatusOK {
+		writeQuotaError(w, status)
+		return
+	}
+
+	upload := &tusUpload{
+		tusID:    uuid.NewString(),
+		id:       uuid.NewString(),
+		filename: filename,
+		// replaced by the detected type once the first bytes arrive
+		contentType: selectContentType(filename),
+		metadata:    r.Header.Get("Upload-Metadata"),
+		length:      length,
+		expires:     time.Now().Add(p.TusExpiration),
+		checksum:    sha512.New(),
+		options:     options,
+		reservation: reservation,
+	}
+	if options.encryptionKey != nil {
+		upload.cipher = options.encryptionKey.Stream(0)
+	}
+	if length == 0 {
+		if p.RequireAge {
+			c.releaseQuota(reservation)
+			http.Error(w, errNotAgeEncrypted.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+		if err := c.finishTusUpload(handlerMainSpan.Context(), upload); err != nil {
+			c.releaseQuota(reservation)
+			traceLog(c.logger, err)
+			sentry.CaptureException(err)
+			w.WriteHeader(storageErrorStatusCode(err))
+			return
+		}
+		c.setTusResultHeaders(w, r, upload)
+	}
+	c.tusUploads.add(upload)
+
+	options.setResponseHeaders(w)
+	w.Header().Set("Location", fmt.Sprintf("%s://%s/files/%s", p.DownloadLinkPrefix, r.Host, upload.tusID))
+	w.Header().Set("Upload-Expires", upload.expires.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (c *Config) TusHeadHandler(w http.ResponseWriter, r *http.Request) {
+	upload := c.lookupTusUpload(w, r)
+	if upload == nil {
+		return
+	}
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.length, 10))
+	if upload.metadata != "" {
+		w.Header().Set("Upload-Metadata", upload.metadata)
+	}
+	// the links of finished uploads are only sent in the response completing the upload
+	if !upload.finished {
+		w.Header().Set("Upload-Expires", upload.expires.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *Config) TusPatchHandler(w http.ResponseWriter, r *http.Request) {
+	handlerMainSpan := sentry.StartSpan(r.Context(), "handler.tus.patch")
+	defer handlerMainSpan.Finish()
+
+	if cancelRequestIfUnhealthy(w) {
+		return
+	}
+	backend, ok := c.multipartBackend(w)
+	if !ok {
+		return
+	}
+	upload := c.lookupTusUpload(w, r)
+	if upload == nil {
+		return
+	}
+	if !upload.patchLock.TryLock() {
+		http.Error(w, "upload is in progress", http.StatusLocked)
+		return
+	}
+	defer upload.patchLock.Unlock()
+
+	if r.Header.Get("Content-Type") != tusOffsetContentType {
+		http.Error(w, "content type must be "+tusOffsetContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+	// offset and finished are only modified while holding patchLock
+	if offset != upload.offset {
+		http.Error(w, "Upload-Offset does not match", http.StatusConflict)
+		return
+	}
+
+	body := io.LimitReader(r.Body, upload.length-upload.offset)
+	copySpan := handlerMainSpan.StartChild("object.copy")
+	chunk := make([]byte, 32*metrics.KB)
+	for {
+		n, readError := body.Read(chunk)
+		if n > 0 {
+			if !upload.inspected {
+				upload.prefix = append(upload.prefix, chunk[:min(n, sniffLength-len(upload.prefix))]...)
+			}
+			// the checksum covers the plaintext, only the stored content is encrypted
+			upload.checksum.Write(chunk[:n])
+			if upload.cipher != nil {
+				upload.cipher.XORKeyStream(chunk[:n], chunk[:n])
+			}
+			upload.buffer.Write(chunk[:n])
+			upload.mutex.Lock()
+			upload.offset += int64(n)
+			upload.mutex.Unlock()
+		}
+		// content type and client encryption are detected from the start of the content, which clients may send in
+		// several small PATCH requests; it is inspected long before the first part is stored
+		if !upload.inspected && (len(upload.prefix) == sniffLength || upload.offset == upload.length) {
+			if err := c.inspectTusContent(copySpan.Context(), upload); err != nil {
+				copySpan.Finish()
+				http.Error(w, err.Error(), uploadErrorStatusCode(err))
+				return
+			}
+		}
+		if upload.buffer.Len() >= tusPartSize {
+			if err := c.flushTusPart(copySpan.Context(), backend, upload); err != nil {
+				copySpan.Status = sentry.SpanStatusInternalError
+				copySpan.Finish()
+				traceLog(c.logger, err)
+				sentry.CaptureException(err)
+				w.WriteHeader(storageErrorStatusCode(err))
+				return
+			}
+		}
+		if readError != nil {
+			// keep everything received so far if the client disconnects; it continues from the stored offset
+			break
+		}
+	}
+	copySpan.Finish()
+
+	if upload.offset == upload.length && !upload.finished {
+		if err := c.finishTusUpload(handlerMainSpan.Context(), upload); err != nil {
+			traceLog(c.logger, err)
+			sentry.CaptureException(err)
+			w.WriteHeader(storageErrorStatusCode(err))
+			return
+		}
+		c.setTusResultHeaders(w, r, upload)
+	}
+
+	upload.mutex.Lock()
+	if !upload.finished {
+		upload.expires = time.Now().Add(p.TusExpiration)
+		w.Header().Set("Upload-Expires", upload.expires.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.offset, 10))
+	upload.mutex.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Config) TusDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	handlerMainSpan := sentry.StartSpan(r.Context(), "handler.tus.delete")
+	defer handlerMainSpan.Finish()
+
+	upload := c.lookupTusUpload(w, r)
+	if upload == nil {
+		return
+	}
+	if !upload.patchLock.TryLock() {
+		http.Error(w, "upload is in progress", http.StatusLocked)
+		return
+	}
+	defer upload.patchLock.Unlock()
+
+	// finished uploads are deleted with their deletion link
+	if upload.finished {
+		http.Error(w, "upload is finished", http.StatusGone)
+		return
+	}
+	if err := c.discardTusUpload(handlerMainSpan.Context(), upload); err != nil {
+		traceLog(c.logger, err)
+		sentry.CaptureException(err)
+		w.WriteHeader(storageErrorStatusCode(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// inspectTusContent - detect content type and client encryption from the collected prefix; rejected uploads are
+// discarded
+func (c *Config) inspectTusContent(ctx context.Context, upload *tusUpload) error {
+	contentType, clientEncryption, err := detectContent(upload.filename, upload.prefix)
+	if err != nil {
+		if discardError := c.discardTusUpload(ctx, upload); discardError != nil {
+			traceLog(c.logger, discardError)
+		}
+		return err
+	}
+	upload.contentType, upload.options.clientEncryption = contentType, clientEncryption
+	upload.inspected = true
+	upload.prefix = nil
+	return nil
+}
+
+// setTusResultHeaders - announce download and delete link of a finished upload
+func (c *Config) setTusResultHeaders(w http.ResponseWriter, r *http.Request, upload *tusUpload) {
+	w.Header().Set(downloadLinkHeader, c.signedDownloadLink(r, upload.id, upload.filename, upload.options.expiry, upload.options.encryptionKey))
+	w.Header().Set(deleteLinkHeader, deleteLink(downloadLink(r, upload.id, upload.filename), upload.options.deletionToken))
+	w.Header().Set(listLinkHeader, c.signedListLink(r, upload.id, upload.options.expiry))
+}
+
+// flushTusPart - store the buffered content as next part of the multipart upload
+func (c *Config) flushTusPart(ctx context.Context, backend storage.MultipartBackend, upload *tusUpload) error {
+	if upload.multipartID == "" {
+		multipartID, err := backend.NewMultipartUpload(ctx, upload.key(), storage.PutOptions{
+			ContentType: upload.contentType,
+		})
+		if err != nil {
+			return err
+		}
+		upload.multipartID = multipartID
+	}
+	part, err := backend.PutPart(ctx, upload.key(), upload.multipartID, len(upload.parts)+1, bytes.NewReader(upload.buffer.Bytes()), int64(upload.buffer.Len()))
+	if err != nil {
+		return err
+	}
+	upload.parts = append(upload.parts, part)
+	upload.buffer.Reset()
+	return nil
+}
+
+// finishTusUpload - assemble the final object and attach the checksum like a plain upload does
+func (c *Config) finishTusUpload(ctx context.Context, upload *tusUpload) error {
+	if upload.multipartID == "" {
+		// small uploads never reached the part size and are stored directly
+		if _, err := c.storage.Put(ctx, upload.key(), bytes.NewReader(upload.buffer.Bytes()), int64(upload.buffer.Len()), storage.PutOptions{
+			ContentType: upload.contentType,
+		}); err != nil {
+			return err
+		}
+	} else {
+		backend := c.storage.(storage.MultipartBackend)
+		if upload.buffer.Len() > 0 {
+			if err := c.flushTusPart(ctx, backend, upload); err != nil {
+				return err
+			}
+		}
+		if _, err := backend.CompleteMultipartUpload(ctx, upload.key(), upload.multipartID, upload.parts); err != nil {
+			return err
+		}
+	}
+	upload.buffer.Reset()
+
+	metadata := upload.options.metadata()
+	metadata[ChecksumMetadataFieldName] = hex.EncodeToString(upload.checksum.Sum(nil))
+	if err := c.storage.SetMetadata(ctx, upload.key(), metadata); err != nil {
+		return err
+	}
+
+	upload.mutex.Lock()
+	upload.finished = true
+	upload.mutex.Unlock()
+
+	c.recordUpload(upload.options, upload.length)
+	c.commitQuota(upload.reservation, upload.length)
+	return nil
+}
+
+// discardTusUpload - free all resources of an unfinished upload
+func (c *Config) discardTusUpload(ctx context.Context, upload *tusUpload) error {
+	if upload.multipartID != "" {
+		if err := c.storage.(storage.MultipartBackend).AbortMultipartUpload(ctx, upload.key(), upload.multipartID); err != nil {
+			return err
+		}
+	}
+	c.tusUploads.remove(upload.tusID)
+	c.releaseQuota(upload.reservation)
+	return nil
+}
+
+// cleanupTusUploads - abort expired resumable uploads and forget about expired finished ones
+func (c *Config) cleanupTusUploads(ctx context.Context) {
+	for _, upload := range c.tusUploads.expired(time.Now()) {
+		if !upload.patchLock.TryLock() {
+			continue
+		}
+		if upload.finished {
+			// the final object is managed by the regular cleanup
+			c.tusUploads.remove(upload.tusID)
+		} else if err := c.discardTusUpload(ctx, upload); err != nil {
+			sentry.CaptureException(err)
+			traceLog(c.logger, err)
+		} else {
+			traceLog(c.logger, "abort expired resumable upload "+upload.key())
+		}
+		upload.patchLock.Unlock()
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+
+	"transfer/internal/metrics"
+)
+
+// tusRequest - perform a tus protocol request and return the response with closed body
+func tusRequest(t *testing.T, method string, url string, headers map[string]string, body []byte) *http.Response {
+	t.Helper()
+	request, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Tus-Resumable", tusVersion)
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	return response
+}
+
+func TestTusUploadFlow(t *testing.T) {
+	server, _ := newTestServer(t)
+	content := bytes.Repeat([]byte("0123456789abcdef"), (tusPartSize+metrics.MB)/16)
+
+	created := tusRequest(t, http.MethodPost, server.URL+"/files/", map[string]string{
+		"Upload-Length":   strconv.Itoa(len(content)),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("large.bin")),
+	}, nil)
+	if created.StatusCode != http.StatusCreated {
+		t.Fatalf("creation failed with status %d", created.StatusCode)
+	}
+	location := created.Header.Get("Location")
+
+	// send the content in two chunks, the first one exceeds the part size
+	split := tusPartSize + 100
+	var link string
+	for _, chunk := range []struct{ offset, end int }{{0, split}, {split, len(content)}} {
+		patched := tusRequest(t, http.MethodPatch, location, map[string]string{
+			"Content-Type":  tusOffsetContentType,
+			"Upload-Offset": strconv.Itoa(chunk.offset),
+		}, content[chunk.offset:chunk.end])
+		if patched.StatusCode != http.StatusNoContent || patched.Header.Get("Upload-Offset") != strconv.Itoa(chunk.end) {
+			t.Fatalf("patch at offset %d returned %d with offset %+q", chunk.offset, patched.StatusCode, patched.Header.Get("Upload-Offset"))
+		}
+		link = patched.Header.Get(downloadLinkHeader)
+	}
+	if link == "" || strings.Contains(link, path.Base(location)) {
+		t.Fatalf("unexpected download link %+q for upload %+q", link, location)
+	}
+
+	// the upload url does not reveal the links of the finished upload nor allows deleting it
+	head := tusRequest(t, http.MethodHead, location, nil, nil)
+	if head.Header.Get("Upload-Offset") != strconv.Itoa(len(content)) || head.Header.Get(downloadLinkHeader) != "" || head.Header.Get(deleteLinkHeader) != "" {
+		t.Fatalf("unexpected headers of finished upload: %v", head.Header)
+	}
+	if response := tusRequest(t, http.MethodDelete, location, nil, nil); response.StatusCode != http.StatusGone {
+		t.Errorf("termination of finished upload returned %d", response.StatusCode)
+	}
+
+	status, downloaded := doRequest(t, http.MethodGet, link, nil)
+	if status != http.StatusOK || downloaded != string(content) {
+		t.Errorf("download returned status %d and %d bytes", status, len(downloaded))
+	}
+	checksum := sha512.Sum512(content)
+	if _, sum := doRequest(t, http.MethodGet, link+"/sum", nil); sum != hex.EncodeToString(checksum[:])+"  large.bin\n" {
+		t.Errorf("unexpected checksum %+q", sum)
+	}
+}
+
+func TestTusProtocolErrors(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	created := tusRequest(t, http.MethodPost, server.URL+"/files/", map[string]string{
+		"Upload-Length":   "10",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("test.txt")),
+	}, nil)
+	location := created.Header.Get("Location")
+
+	if response := tusRequest(t, http.MethodPatch, location, map[string]string{
+		"Content-Type":  tusOffsetContentType,
+		"Upload-Offset": "5",
+	}, []byte("12345")); response.StatusCode != http.StatusConflict {
+		t.Errorf("offset mismatch returned %d", response.StatusCode)
+	}
+
+	request, _ := http.NewRequest(http.MethodHead, location, nil)
+	if response, err := http.DefaultClient.Do(request); err != nil || response.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("missing Tus-Resumable header was accepted: %v", err)
+	}
+
+	if response := tusRequest(t, http.MethodDelete, location, nil, nil); response.StatusCode != http.StatusNoContent {
+		t.Errorf("termination returned %d", response.StatusCode)
+	}
+	if response := tusRequest(t, http.MethodHead, location, nil, nil); response.StatusCode != http.StatusNotFound {
+		t.Errorf("terminated upload returned %d", response.StatusCode)
+	}
+}
+
+func TestTusContentInspectedAcrossPatches(t *testing.T) {
+	server, c := newTestServer(t)
+	p.RequireAge = true
+
+	// upload content in chunks shorter than the age header
+	upload := func(content []byte) (*http.Response, string) {
+		created := tusRequest(t, http.MethodPost, server.URL+"/files/", map[string]string{
+			"Upload-Length":   strconv.Itoa(len(content)),
+			"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("secret.age")),
+		}, nil)
+		location := created.Header.Get("Location")
+		var patched *http.Response
+		for offset := 0; offset < len(content); offset += 4 {
+			patched = tusRequest(t, http.MethodPatch, location, map[string]string{
+				"Content-Type":  tusOffsetContentType,
+				"Upload-Offset": strconv.Itoa(offset),
+			}, content[offset:min(offset+4, len(content))])
+			if patched.StatusCode != http.StatusNoContent {
+				break
+			}
+		}
+		return patched, location
+	}
+
+	patched, _ := upload([]byte(ageMagic + "-> X25519 stanza\nciphertext"))
+	if patched.StatusCode != http.StatusNoContent {
+		t.Fatalf("age encrypted upload returned %d", patched.StatusCode)
+	}
+	object, err := c.storage.Stat(t.Context(), strings.TrimPrefix(patched.Header.Get(downloadLinkHeader), server.URL+"/"))
+	if err != nil || object.UserMetadata[ClientEncryptionMetadataFieldName] != clientEncryptionAge {
+		t.Errorf("client encryption not detected: %v, %v", object.UserMetadata, err)
+	}
+
+	patched, location := upload([]byte("plaintext which is not encrypted"))
+	if patched.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("plaintext upload returned %d", patched.StatusCode)
+	}
+	if head := tusRequest(t, http.MethodHead, location, nil, nil); head.StatusCode != http.StatusNotFound {
+		t.Errorf("rejected upload is still available with status %d", head.StatusCode)
+	}
+}
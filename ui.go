@@ -0,0 +1,116 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+
+	"transfer/internal/encryption"
+	"transfer/internal/storage"
+)
+
+// webFiles - templates and static assets of the browser interface
+//
+//go:embed web
+var webFiles embed.FS
+
+var templates = template.Must(template.ParseFS(webFiles, "web/*.html"))
+
+// previewPage - data of the preview template
+type previewPage struct {
+	uploadResult
+	HumanSize string
+	// Kind - how the file is previewed: image, video, audio, pdf, text or empty for no preview
+	Kind string
+	// RawURL - link returning the content instead of the preview page, always on the same host
+	RawURL string
+	// DownloadURL - link returning the content as attachment, on the content domain if configured
+	DownloadURL string
+	// InlineURL - link returning the content for display inside the preview page, on the content domain if configured
+	InlineURL string
+}
+
+// previewKind - kind of inline preview for content of contentType, empty if the browser must not display it
+func previewKind(contentType string) string {
+	mediaType := mediaType(contentType)
+	switch {
+	// text is inserted as plain text by the preview page, never rendered by the browser
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/json":
+		return "text"
+	case !inlineAllowed(mediaType):
+		return ""
+	case strings.HasPrefix(mediaType, "image/"):
+		return "image"
+	case strings.HasPrefix(mediaType, "video/"):
+		return "video"
+	case strings.HasPrefix(mediaType, "audio/"):
+		return "audio"
+	case mediaType == "application/pdf":
+		return "pdf"
+	}
+	return ""
+}
+
+// wantsPreview - whether the request comes from a browser navigating to a download link
+func wantsPreview(r *http.Request) bool {
+	return r.Method == http.MethodGet && !r.URL.Query().Has("raw") && !onContentDomain(r) &&
+		negotiateContentType(r, "application/octet-stream", "text/html") == "text/html"
+}
+
+// withQuery - path and query of r with an additional query parameter
+func withQuery(r *http.Request, parameter string) string {
+	link := *r.URL
+	query := link.Query()
+	query.Set(parameter, "1")
+	link.RawQuery = query.Encode()
+	return link.RequestURI()
+}
+
+// renderPreview - write the preview page of object
+func (c *Config) renderPreview(w http.ResponseWriter, r *http.Request, object storage.Object, key *encryption.Key) {
+	page := previewPage{
+		uploadResult: c.resultFromObject(r, object, key),
+		HumanSize:    humanize.IBytes(uint64(object.Size)),
+		Kind:         previewKind(object.ContentType),
+		RawURL:       withQuery(r, "raw"),
+		DownloadURL:  contentOrigin() + withQuery(r, "raw"),
+		InlineURL:    contentOrigin() + withQuery(r, "inline"),
+	}
+	// the preview would use up downloads of limited files
+	if page.MaxDownloads > 0 || page.Encryption != "" {
+		page.Kind = ""
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Add("Vary", "Accept")
+	setPageSecurityHeaders(w)
+	if err := templates.ExecuteTemplate(w, "preview.html", page); err != nil {
+		traceLog(c.logger, err)
+	}
+}
+
+// IndexHandler - upload page for browsers
+func (c *Config) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	setPageSecurityHeaders(w)
+	data := struct {
+		Origin string
+		// AuthRequired - uploads need a token of the credentials file
+		AuthRequired bool
+	}{Origin: p.DownloadLinkPrefix + "://" + r.Host, AuthRequired: c.credentials != nil}
+	if err := templates.ExecuteTemplate(w, "index.html", data); err != nil {
+		traceLog(c.logger, err)
+	}
+}
+
+// staticHandler - serve the static assets of the browser interface below /static/
+func staticHandler() http.Handler {
+	static, err := fs.Sub(webFiles, "web/static")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+}
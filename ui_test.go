@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"transfer/internal/auth"
+)
+
+func TestPreviewNegotiation(t *testing.T) {
+	server, _ := newTestServer(t)
+	const content = "previewed text"
+	const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+	status, link := doRequest(t, http.MethodPut, server.URL+"/notes.txt", strings.NewReader(content))
+	if status != http.StatusOK {
+		t.Fatalf("upload failed with status %d", status)
+	}
+	link = strings.TrimSpace(link)
+
+	tests := []struct {
+		Name        string
+		URL         string
+		Accept      string
+		ContentType string
+		Contains    string
+	}{
+		{Name: "curl", URL: link, Accept: "*/*", ContentType: "text/plain; charset=utf-8", Contains: content},
+		{Name: "browser", URL: link, Accept: browserAccept, ContentType: "text/html; charset=utf-8", Contains: "<h1>notes.txt</h1>"},
+		{Name: "browser raw", URL: link + "?raw=1", Accept: browserAccept, ContentType: "text/plain; charset=utf-8", Contains: content},
+		{Name: "index", URL: server.URL + "/", Accept: browserAccept, ContentType: "text/html; charset=utf-8", Contains: `id="dropzone"`},
+		{Name: "static", URL: server.URL + "/static/upload.js", Accept: "*/*", ContentType: "text/javascript; charset=utf-8", Contains: "XMLHttpRequest"},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			request := mustRequest(t, http.MethodGet, test.URL, nil)
+			request.Header.Set("Accept", test.Accept)
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			body, _ := io.ReadAll(response.Body)
+			if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != test.ContentType {
+				t.Fatalf("returned %d with content type %+q", response.StatusCode, response.Header.Get("Content-Type"))
+			}
+			if !strings.Contains(string(body), test.Contains) {
+				t.Errorf("expected %+q in response:\n%s", test.Contains, body)
+			}
+		})
+	}
+}
+
+func Test_previewKind(t *testing.T) {
+	p = Parameters{InlineTypes: defaultInlineTypes}
+	tests := map[string]string{
+		"image/png":                 "image",
+		"image/svg+xml":             "",
+		"video/mp4":                 "video",
+		"application/pdf":           "pdf",
+		"text/plain; charset=utf-8": "text",
+		"text/html; charset=utf-8":  "text",
+		"application/octet-stream":  "",
+	}
+	for contentType, expected := range tests {
+		if kind := previewKind(contentType); kind != expected {
+			t.Errorf("%+q: expected %+q, got %+q", contentType, expected, kind)
+		}
+	}
+}
+
+func TestIndexTokenField(t *testing.T) {
+	server, c := newTestServer(t)
+	index := func() string {
+		request := mustRequest(t, http.MethodGet, server.URL+"/", nil)
+		request.Header.Set("Accept", "text/html")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		return string(body)
+	}
+
+	if strings.Contains(index(), `name="token"`) {
+		t.Error("token field shown without authentication")
+	}
+	c.credentials = auth.Credentials{{Name: "ci", Token: "secret"}}
+	if !strings.Contains(index(), `name="token"`) {
+		t.Error("token field missing although uploads require authentication")
+	}
+}
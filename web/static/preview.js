@@ -0,0 +1,12 @@
+"use strict";
+
+document.getElementById("copy-link").addEventListener("click", () => navigator.clipboard.writeText(location.href));
+
+const text = document.getElementById("text-preview");
+if (text !== null) {
+  // only the beginning of large files is shown; textContent never interprets the content as markup
+  fetch(text.dataset.src, {headers: {Range: "bytes=0-1048575"}})
+    .then((response) => response.ok ? response.text() : Promise.reject(response.statusText))
+    .then((content) => text.textContent = content)
+    .catch((error) => text.textContent = `Preview failed: ${error}`);
+}
@@ -0,0 +1,88 @@
+"use strict";
+
+const form = document.getElementById("upload");
+const input = document.getElementById("files");
+const dropzone = document.getElementById("dropzone");
+const progress = document.getElementById("progress");
+const status = document.getElementById("status");
+const results = document.getElementById("results");
+
+for (const event of ["dragenter", "dragover"]) {
+  dropzone.addEventListener(event, (e) => {
+    e.preventDefault();
+    dropzone.classList.add("active");
+  });
+}
+for (const event of ["dragleave", "drop"]) {
+  dropzone.addEventListener(event, () => dropzone.classList.remove("active"));
+}
+dropzone.addEventListener("drop", (e) => {
+  e.preventDefault();
+  input.files = e.dataTransfer.files;
+  form.requestSubmit();
+});
+
+function addResult(result) {
+  const item = document.createElement("li");
+  const link = document.createElement("a");
+  link.href = result.url;
+  // the link points to the ascii name, its text shows the name as uploaded
+  link.textContent = result.original_filename || result.filename;
+  const copy = document.createElement("button");
+  copy.type = "button";
+  copy.textContent = "Copy link";
+  copy.addEventListener("click", () => navigator.clipboard.writeText(result.url));
+  item.append(link, " ", copy);
+  results.append(item);
+}
+
+form.addEventListener("submit", (e) => {
+  e.preventDefault();
+  const data = new FormData();
+  for (const file of input.files) {
+    data.append("file", file);
+  }
+
+  const request = new XMLHttpRequest();
+  request.open("POST", "/");
+  request.setRequestHeader("Accept", "application/json");
+  for (const [field, header] of [["max-days", "Max-Days"], ["max-downloads", "Max-Downloads"], ["password", "X-Download-Password"]]) {
+    const value = form.elements[field].value;
+    if (value !== "") {
+      request.setRequestHeader(header, value);
+    }
+  }
+  // the token field is only shown if the server requires authentication
+  const token = form.elements["token"]?.value ?? "";
+  if (token !== "") {
+    request.setRequestHeader("Authorization", `Bearer ${token}`);
+  }
+  request.upload.addEventListener("progress", (event) => {
+    if (event.lengthComputable) {
+      progress.value = event.loaded / event.total;
+    }
+  });
+  request.addEventListener("load", () => {
+    progress.hidden = true;
+    if (request.status !== 200) {
+      status.textContent = `Upload failed: ${request.status} ${request.responseText}`;
+      return;
+    }
+    status.textContent = "Upload complete";
+    JSON.parse(request.responseText).forEach(addResult);
+    form.reset();
+    // keep the token for further uploads
+    if (form.elements["token"]) {
+      form.elements["token"].value = token;
+    }
+  });
+  request.addEventListener("error", () => {
+    progress.hidden = true;
+    status.textContent = "Upload failed";
+  });
+
+  progress.value = 0;
+  progress.hidden = false;
+  status.textContent = "Uploading…";
+  request.send(data);
+});
@@ -6,13 +6,12 @@ import (
 	"time"
 
 	"github.com/getsentry/sentry-go"
-	"github.com/minio/minio-go/v7"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"transfer/internal/metrics"
 )
 
-// HealthCheckWorker - Worker for checking health of s3 backend
+// HealthCheckWorker - Worker for checking health of the storage backend
 func (c *Config) HealthCheckWorker(ctx context.Context, done chan<- interface{}) {
 	var sleepCounter int
 	for {
@@ -24,9 +23,8 @@ func (c *Config) HealthCheckWorker(ctx context.Context, done chan<- interface{})
 			if sleepCounter/p.HealthCheckInterval == 0 {
 				break
 			}
-			exist, err := c.minioClient.BucketExists(ctx, p.S3BucketName)
-			if err != nil || !exist {
-				traceLog(c.logger, fmt.Sprintf("bucket does not exist or error while checking: %#q", err))
+			if err := c.storage.Health(ctx); err != nil {
+				traceLog(c.logger, fmt.Sprintf("storage backend check failed: %#q", err))
 				if backendState == StateHealthy {
 					backendState = StateUnhealthy
 					traceLog(c.logger, fmt.Sprintf("switching to state %+q\n", backendState))
@@ -46,7 +44,7 @@ func (c *Config) HealthCheckWorker(ctx context.Context, done chan<- interface{})
 	}
 }
 
-// CleanupWorker - Worker for deleting objects after 1 hour
+// CleanupWorker - Worker for deleting objects after their expiry or download limit is reached
 func (c *Config) CleanupWorker(ctx context.Context, done chan<- interface{}) {
 	var sleepCounter int
 	for {
@@ -60,32 +58,8 @@ func (c *Config) CleanupWorker(ctx context.Context, done chan<- interface{}) {
 			}
 			if backendState != StateHealthy {
 				traceLog(c.logger, "skip cleanup because of unhealthy backend")
-			}
-
-			for object := range c.minioClient.ListObjects(ctx, p.S3BucketName, minio.ListObjectsOptions{Recursive: true}) {
-				if object.Key == "" {
-					traceLog(c.logger, fmt.Sprintf("object has empty key %#v\n", object))
-					break
-				}
-				if object.LastModified.Add(1 * time.Hour).Before(time.Now()) {
-					sentryCleanupSpan := sentry.StartSpan(
-						context.Background(),
-						"object.cleanup",
-						sentry.WithTransactionName(fmt.Sprintf("cleanup %+q", object.Key)),
-					)
-					sentryCleanupSpan.SetTag("object.key", object.Key)
-
-					traceLog(c.logger, "remove "+object.Key)
-					metrics.ObjectAction.With(prometheus.Labels{"action": "delete"}).Inc()
-					if err := c.minioClient.RemoveObject(sentryCleanupSpan.Context(), p.S3BucketName, object.Key, minio.RemoveObjectOptions{}); err != nil {
-						sentryCleanupSpan.Status = sentry.SpanStatusInternalError
-						sentry.CaptureException(err)
-						traceLog(c.logger, err)
-					} else {
-						sentryCleanupSpan.Status = sentry.SpanStatusOK
-					}
-					sentryCleanupSpan.Finish()
-				}
+			} else {
+				c.cleanup(ctx)
 			}
 			sleepCounter = 0
 		}
@@ -93,3 +67,55 @@ func (c *Config) CleanupWorker(ctx context.Context, done chan<- interface{}) {
 		time.Sleep(1 * time.Second)
 	}
 }
+
+// cleanup - delete expired objects and resumable uploads and refresh the quota usage; returns the number of deleted
+// objects
+func (c *Config) cleanup(ctx context.Context) int {
+	c.cleanupMutex.Lock()
+	defer c.cleanupMutex.Unlock()
+
+	var removed int
+	for listed, err := range c.storage.List(ctx, "") {
+		if err != nil {
+			traceLog(c.logger, fmt.Sprintf("listing objects failed: %#q", err))
+			break
+		}
+		if listed.Key == "" {
+			traceLog(c.logger, fmt.Sprintf("object has empty key %#v\n", listed))
+			break
+		}
+		// listings of s3 do not contain the retention metadata
+		object, err := c.storage.Stat(ctx, listed.Key)
+		if err != nil {
+			traceLog(c.logger, err)
+			continue
+		}
+		if objectGone(object, time.Now()) {
+			sentryCleanupSpan := sentry.StartSpan(
+				context.Background(),
+				"object.cleanup",
+				sentry.WithTransactionName(fmt.Sprintf("cleanup %+q", object.Key)),
+			)
+			sentryCleanupSpan.SetTag("object.key", object.Key)
+
+			traceLog(c.logger, "remove "+object.Key)
+			metrics.ObjectAction.With(prometheus.Labels{"action": "delete"}).Inc()
+			if err := c.storage.Delete(sentryCleanupSpan.Context(), object.Key); err != nil {
+				sentryCleanupSpan.Status = sentry.SpanStatusInternalError
+				sentry.CaptureException(err)
+				traceLog(c.logger, err)
+			} else {
+				sentryCleanupSpan.Status = sentry.SpanStatusOK
+				removed++
+			}
+			sentryCleanupSpan.Finish()
+		}
+	}
+	c.cleanupTusUploads(ctx)
+	if c.credentials != nil {
+		if err := c.refreshQuotaUsage(ctx); err != nil {
+			traceLog(c.logger, fmt.Sprintf("refreshing quota usage failed: %#q", err))
+		}
+	}
+	return removed
+}